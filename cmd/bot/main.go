@@ -6,17 +6,22 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
+	cachebackend "github.com/cr00z/goSpendingBot/internal/cache/backend"
 	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_redis"
 	"github.com/cr00z/goSpendingBot/internal/clients/tg"
-	"github.com/cr00z/goSpendingBot/internal/config"
+	cfg "github.com/cr00z/goSpendingBot/internal/config"
 	"github.com/cr00z/goSpendingBot/internal/currency/cbrcurrency"
 	grpc_report "github.com/cr00z/goSpendingBot/internal/grpc/report/server"
 	producer "github.com/cr00z/goSpendingBot/internal/kafka/producers"
 	"github.com/cr00z/goSpendingBot/internal/model/messages"
 	"github.com/cr00z/goSpendingBot/internal/observability"
-	"github.com/cr00z/goSpendingBot/internal/repository/postgres_sql"
+	"github.com/cr00z/goSpendingBot/internal/report_service/local"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/backend"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 )
@@ -35,13 +40,29 @@ func main() {
 
 	logger := observability.InitLogger(*develMode)
 
-	observability.InitTracing(logger)
+	observability.InitTracing(logger, "gospend-bot")
 
-	config, err := config.New()
+	config, err := cfg.New()
 	if err != nil {
 		logger.Fatal("config init failed: ", zap.Error(err))
 	}
 
+	storageOptions := backend.Options{
+		Type:          config.Storage(),
+		EnvFile:       "build/bot/environment.dev",
+		SqlitePath:    config.SqlitePath(),
+		MigrateOutput: zap.NewStdLog(logger).Writer(),
+	}
+
+	// bot migrate status|up|down
+	if flag.Arg(0) == "migrate" {
+		err = backend.Migrate(ctx, storageOptions, flag.Arg(1), os.Stdout)
+		if err != nil {
+			logger.Fatal("migrate failed: ", zap.Error(err))
+		}
+		return
+	}
+
 	metricsSrv := observability.NewMetricsServer(logger)
 	metricsSrv.Start()
 
@@ -50,14 +71,52 @@ func main() {
 		logger.Fatal("tg client init failed: ", zap.Error(err))
 	}
 
-	db, err := postgres_sql.OpenAndConnect("build/bot/environment.dev")
+	spRepository, err := backend.Open(ctx, storageOptions)
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
-	spRepository := postgres_sql.New(db)
 
-	currencyCache := cache_lru.NewLRUCache("currency", config.CurrencyCacheSize())
-	reportCache := cache_lru.NewLRUCache("report", config.ReportCacheSize())
+	var redisOptions *cache_redis.Options
+	if config.CacheBackend() == cfg.CacheBackendRedis {
+		redis := config.Redis()
+		redisOptions = &cache_redis.Options{
+			Addr:     redis.Addr,
+			Password: redis.Password,
+			DB:       redis.DB,
+			Prefix:   redis.Prefix,
+			Logger:   logger,
+		}
+	}
+	currencyCache, err := cachebackend.New[int64, string](ctx, &wg, cachebackend.Options{
+		Name:     "currency",
+		Policy:   config.CurrencyCachePolicy(),
+		Capacity: config.CurrencyCacheSize(),
+		TTL:      config.CurrencyCacheTTL(),
+		Shards:   config.CacheShards(),
+		Redis:    redisOptions,
+	}, cache_lru.HashInt64)
+	if err != nil {
+		logger.Fatal("currency cache init failed: ", zap.Error(err))
+	}
+	// Модель создается после кэша, до этого у нее нет запросов рапортов,
+	// которым могут помешать инвалидации других реплик
+	var reportModel atomic.Pointer[messages.Model]
+	reportCache, err := cachebackend.New[string, *repository.Report](ctx, &wg, cachebackend.Options{
+		Name:     "report",
+		Policy:   config.ReportCachePolicy(),
+		Capacity: config.ReportCacheSize(),
+		TTL:      config.ReportCacheTTL(),
+		Shards:   config.CacheShards(),
+		Redis:    redisOptions,
+		OnRemoteInvalidate: func(key string) {
+			if model := reportModel.Load(); model != nil {
+				model.ReportCacheInvalidated(key)
+			}
+		},
+	}, cache_lru.HashString)
+	if err != nil {
+		logger.Fatal("report cache init failed: ", zap.Error(err))
+	}
 
 	cbrCurrency, err := cbrcurrency.NewCbrCurrencyStorage(ctx, &wg, logger)
 	if err != nil {
@@ -67,31 +126,68 @@ func main() {
 		)
 	}
 
-	reportService, err := producer.New(producer.ProducerOptions{
-		KafkaTopic:  KafkaTopic,
-		BrokersList: BrokersList,
-	})
-	if err != nil {
-		logger.Fatal(err.Error())
-	}
-
-	msgModel := messages.New(tgClient, spRepository, currencyCache, reportCache, cbrCurrency, reportService)
-
-	go func() {
-		err = grpc_report.NewServer(msgModel, tgClient)
+	var reportService producer.ReportProducer
+	var localReports *local.Producer
+	if config.Reports() == cfg.ReportsLocal {
+		localReports = local.New(spRepository, logger)
+		reportService = localReports
+	} else {
+		reportService, err = producer.New(producer.ProducerOptions{
+			KafkaTopic:  KafkaTopic,
+			BrokersList: BrokersList,
+		})
 		if err != nil {
 			logger.Fatal(err.Error())
 		}
-	}()
+	}
 
-	go tgClient.ListenUpdates(ctx, &wg, msgModel)
+	msgModel := messages.New(tgClient, spRepository, currencyCache, reportCache, cbrCurrency, reportService)
+	reportModel.Store(msgModel)
+
+	if localReports != nil {
+		localReports.SetReceiver(msgModel.DeliverReport)
+	} else {
+		go func() {
+			err = grpc_report.NewServer(msgModel)
+			if err != nil {
+				logger.Fatal(err.Error())
+			}
+		}()
+	}
+
+	if config.UpdatesMode() == cfg.UpdatesModeWebhook {
+		webhook := config.Webhook()
+		go func() {
+			err := tgClient.ListenWebhook(ctx, &wg, msgModel, tg.WebhookOptions{
+				URL:         webhook.URL,
+				ListenAddr:  webhook.ListenAddr,
+				SecretToken: webhook.SecretToken,
+				CertFile:    webhook.CertFile,
+				KeyFile:     webhook.KeyFile,
+			})
+			if err != nil {
+				// Без вебхука бот не получает сообщения, завершаем работу
+				logger.Error("webhook failed", zap.Error(err))
+				cancelFn()
+			}
+		}()
+	} else {
+		go tgClient.ListenUpdates(ctx, &wg, msgModel)
+	}
 
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
-	<-termChan
+	select {
+	case <-termChan:
+	case <-ctx.Done():
+	}
 	cancelFn()
 
 	metricsSrv.Stop()
 
 	wg.Wait()
+	if localReports != nil {
+		localReports.Wait()
+	}
+	tgClient.Close()
 }
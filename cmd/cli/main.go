@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/clients/cli"
+	"github.com/cr00z/goSpendingBot/internal/currency"
+	"github.com/cr00z/goSpendingBot/internal/currency/cbrcurrency"
+	"github.com/cr00z/goSpendingBot/internal/currency/fixedcurrency"
+	"github.com/cr00z/goSpendingBot/internal/model/messages"
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	"github.com/cr00z/goSpendingBot/internal/report_service/local"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/memory"
+	"go.uber.org/zap"
+)
+
+var (
+	develMode = flag.Bool("devel", false, "development mode")
+	userID    = flag.Int64("user", 1, "user id for incoming messages")
+	prompt    = flag.Bool("prompt", true, "print prompt before input")
+	cbr       = flag.Bool("cbr", false, "load currencies from cbr.ru instead of RUB only")
+
+	cacheSize = 100
+)
+
+func main() {
+	ctx, cancelFn := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancelFn()
+	var wg sync.WaitGroup
+	flag.Parse()
+
+	logger := observability.InitLogger(*develMode)
+
+	cliClient := cli.New(os.Stdout, *prompt, logger)
+
+	spRepository := memory.NewMemoryStorage()
+
+	currencyCache := cache_lru.NewLRUCache[int64, string]("currency", cacheSize)
+	reportCache := cache_lru.NewLRUCache[string, *repository.Report]("report", cacheSize)
+
+	var currencies currency.CurrencyStorager = fixedcurrency.NewFixedCurrencyStorage(nil)
+	if *cbr {
+		cbrCurrency, err := cbrcurrency.NewCbrCurrencyStorage(ctx, &wg, logger)
+		if err != nil {
+			logger.Warn(
+				"currency storage temporary failed",
+				zap.Error(err),
+			)
+		}
+		currencies = cbrCurrency
+	}
+
+	reportService := local.New(spRepository, logger)
+
+	msgModel := messages.New(cliClient, spRepository, currencyCache, reportCache, currencies, reportService)
+	reportService.SetReceiver(msgModel.DeliverReport)
+
+	err := cliClient.ListenInput(ctx, os.Stdin, *userID, msgModel, reportService)
+	if err != nil {
+		logger.Error("reading input failed", zap.Error(err))
+	}
+
+	cancelFn()
+	wg.Wait()
+}
@@ -6,11 +6,13 @@ import (
 	"os"
 	"os/signal"
 
+	cfg "github.com/cr00z/goSpendingBot/internal/config"
 	consumer "github.com/cr00z/goSpendingBot/internal/kafka/consumers"
 	"github.com/cr00z/goSpendingBot/internal/observability"
 	"github.com/cr00z/goSpendingBot/internal/report_service/model"
-	"github.com/cr00z/goSpendingBot/internal/repository/postgres_sql"
+	"github.com/cr00z/goSpendingBot/internal/repository/backend"
 	_ "github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 var (
@@ -27,12 +29,22 @@ func main() {
 	flag.Parse()
 
 	logger := observability.InitLogger(*develMode)
+	observability.InitTracing(logger, "gospend-report-service")
 
-	db, err := postgres_sql.OpenAndConnect("build/bot/environment.dev")
+	config, err := cfg.New()
+	if err != nil {
+		logger.Fatal("config init failed: ", zap.Error(err))
+	}
+
+	spRepository, err := backend.Open(ctx, backend.Options{
+		Type:          config.Storage(),
+		EnvFile:       "build/bot/environment.dev",
+		SqlitePath:    config.SqlitePath(),
+		MigrateOutput: zap.NewStdLog(logger).Writer(),
+	})
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
-	spRepository := postgres_sql.New(db)
 
 	reportServiceModel := model.New(spRepository)
 
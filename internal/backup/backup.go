@@ -0,0 +1,118 @@
+// Package backup переводит данные юзера в версионированный JSON документ и обратно
+package backup
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Version - текущая версия формата документа.
+// При несовместимом изменении формата версия увеличивается, а Unmarshal
+// продолжает читать документы старых версий
+const Version = 1
+
+// Максимальный размер документа, который принимает Unmarshal
+const MaxSize = 5 << 20
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+	ErrInvalidDocument    = errors.New("invalid backup document")
+)
+
+// Даты хранятся с точностью postgres, чтобы копия одинаково загружалась в любое хранилище
+const datePrecision = time.Microsecond
+
+type document struct {
+	Version    int              `json:"version"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Currency   string           `json:"currency"`
+	Limit      *decimal.Decimal `json:"limit,omitempty"`
+	Categories []string         `json:"categories"`
+	Spendings  []spending       `json:"spendings"`
+}
+
+type spending struct {
+	Category string          `json:"category"`
+	Amount   decimal.Decimal `json:"amount"`
+	Date     time.Time       `json:"date"`
+}
+
+// Marshal возвращает документ резервной копии данных юзера
+func Marshal(data *repository.UserData, createdAt time.Time) ([]byte, error) {
+	doc := document{
+		Version:    Version,
+		CreatedAt:  createdAt.Truncate(time.Second),
+		Currency:   data.Currency,
+		Limit:      data.Limit,
+		Categories: data.Categories,
+		Spendings:  make([]spending, 0, len(data.Spendings)),
+	}
+	if doc.Categories == nil {
+		doc.Categories = []string{}
+	}
+	for _, sp := range data.Spendings {
+		doc.Spendings = append(doc.Spendings, spending{
+			Category: sp.CategoryName,
+			Amount:   sp.Amount,
+			Date:     sp.Date.Truncate(datePrecision),
+		})
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return b, errors.Wrap(err, "backup marshal")
+}
+
+// Unmarshal читает и проверяет документ резервной копии
+func Unmarshal(b []byte) (*repository.UserData, error) {
+	if len(b) > MaxSize {
+		return nil, errors.Wrap(ErrInvalidDocument, "document too large")
+	}
+
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(ErrInvalidDocument, err.Error())
+	}
+	if doc.Version == 0 {
+		return nil, errors.Wrap(ErrInvalidDocument, "version is missing")
+	}
+	if doc.Version > Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	data := &repository.UserData{
+		Categories: doc.Categories,
+		Spendings:  make([]*repository.SpendingData, 0, len(doc.Spendings)),
+		Limit:      doc.Limit,
+		Currency:   doc.Currency,
+	}
+	for _, name := range doc.Categories {
+		if name == "" {
+			return nil, errors.Wrap(ErrInvalidDocument, "empty category name")
+		}
+	}
+	for i, sp := range doc.Spendings {
+		if sp.Category == "" {
+			return nil, errors.Wrapf(ErrInvalidDocument, "spending %d: empty category", i)
+		}
+		if !sp.Amount.IsPositive() {
+			return nil, errors.Wrapf(ErrInvalidDocument, "spending %d: amount must be positive", i)
+		}
+		if sp.Date.IsZero() {
+			return nil, errors.Wrapf(ErrInvalidDocument, "spending %d: date is missing", i)
+		}
+		data.Spendings = append(data.Spendings, &repository.SpendingData{
+			CategoryName: sp.Category,
+			Amount:       sp.Amount,
+			Date:         sp.Date.Truncate(datePrecision),
+		})
+	}
+	if data.Limit != nil && data.Limit.IsNegative() {
+		return nil, errors.Wrap(ErrInvalidDocument, "limit must not be negative")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// документ читается обратно без потерь, даты с точностью до микросекунд
+func TestBackup_MarshalUnmarshal_RoundTrip(t *testing.T) {
+	// Arrange
+	limit := decimal.RequireFromString("1500.5")
+	date := time.Date(2022, time.November, 20, 12, 30, 15, 123456789, time.UTC)
+	data := &repository.UserData{
+		Categories: []string{"food", "taxi"},
+		Spendings: []*repository.SpendingData{
+			{CategoryName: "food", Amount: decimal.RequireFromString("450.25"), Date: date},
+		},
+		Limit:    &limit,
+		Currency: "USD",
+	}
+
+	// Act
+	b, err := Marshal(data, date)
+	require.NoError(t, err)
+	restored, err := Unmarshal(b)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"version": 1`)
+	assert.Equal(t, data.Categories, restored.Categories)
+	assert.Equal(t, "USD", restored.Currency)
+	assert.True(t, limit.Equal(*restored.Limit))
+	if assert.Len(t, restored.Spendings, 1) {
+		assert.Equal(t, "food", restored.Spendings[0].CategoryName)
+		assert.Equal(t, "450.25", restored.Spendings[0].Amount.String())
+		assert.True(t, date.Truncate(time.Microsecond).Equal(restored.Spendings[0].Date))
+	}
+}
+
+// пустой аккаунт сохраняется без лимита и с пустыми списками
+func TestBackup_Marshal_EmptyData_NoLimit(t *testing.T) {
+	// Act
+	b, err := Marshal(&repository.UserData{Currency: "RUB"}, time.Now())
+
+	// Assert
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), `"limit"`)
+	assert.Contains(t, string(b), `"categories": []`)
+	assert.Contains(t, string(b), `"spendings": []`)
+}
+
+// неподдерживаемые и испорченные документы отклоняются
+func TestBackup_Unmarshal_InvalidDocument_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		err      error
+	}{
+		{"not json", `spendings`, ErrInvalidDocument},
+		{"no version", `{"categories": []}`, ErrInvalidDocument},
+		{"future version", `{"version": 2}`, ErrUnsupportedVersion},
+		{"empty category", `{"version": 1, "categories": [""]}`, ErrInvalidDocument},
+		{"negative amount", `{"version": 1, "spendings": [{"category": "food", "amount": "-1", "date": "2022-11-20T12:00:00Z"}]}`, ErrInvalidDocument},
+		{"no date", `{"version": 1, "spendings": [{"category": "food", "amount": "1"}]}`, ErrInvalidDocument},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := Unmarshal([]byte(tt.document))
+
+			// Assert
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
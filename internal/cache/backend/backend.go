@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_arc"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lfu"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	PolicyLRU = "lru"
+	PolicyLFU = "lfu"
+	PolicyARC = "arc"
+)
+
+const defaultJanitorInterval = time.Minute
+
+var (
+	ErrUnknownPolicy      = errors.New("unknown cache policy")
+	ErrShardsNotSupported = errors.New("shards are supported only by lru cache")
+	ErrRedisPolicy        = errors.New("redis cache supports only lru policy without shards")
+)
+
+type Options struct {
+	// Имя кэша в метриках
+	Name string
+	// Политика вытеснения, по умолчанию lru
+	Policy string
+	// Максимальное количество элементов
+	Capacity int
+	// Срок жизни элементов по умолчанию, 0 - бессрочно
+	TTL time.Duration
+	// Больше 1 - кэш делится на независимо блокируемые шарды, только для lru
+	Shards int
+	// Период удаления протухших элементов, по умолчанию минута
+	JanitorInterval time.Duration
+	// Если задан, значения хранятся в redis, общем для всех реплик бота,
+	// а Capacity ограничивает локальные копии
+	Redis *cache_redis.Options
+	// Только для redis: вызывается с ключом, который изменила или удалила другая реплика
+	OnRemoteInvalidate func(key string)
+}
+
+// New создает кэш выбранной в конфиге политики с метриками и запускает удаление
+// протухших элементов до отмены ctx. hash нужен для выбора шарда
+func New[K comparable, V any](ctx context.Context, wg *sync.WaitGroup,
+	options Options, hash func(K) uint64) (cache.Cache[K, V], error) {
+
+	if options.Shards > 1 && options.Policy != "" && options.Policy != PolicyLRU {
+		return nil, errors.Wrap(ErrShardsNotSupported, options.Policy)
+	}
+
+	var c cache.Cache[K, V]
+	if options.Redis != nil {
+		if options.Shards > 1 || (options.Policy != "" && options.Policy != PolicyLRU) {
+			return nil, errors.Wrap(ErrRedisPolicy, options.Policy)
+		}
+		redisOptions := *options.Redis
+		redisOptions.OnInvalidate = options.OnRemoteInvalidate
+		redisCache, err := cache_redis.New[K, V](ctx, wg, options.Name, options.Capacity,
+			options.TTL, redisOptions)
+		if err != nil {
+			return nil, err
+		}
+		return withJanitor[K, V](ctx, wg, options, redisCache), nil
+	}
+
+	switch options.Policy {
+	case "", PolicyLRU:
+		if options.Shards > 1 {
+			c = cache_lru.NewShardedLRUCacheWithTTL[K, V](options.Name, options.Capacity,
+				options.Shards, options.TTL, hash)
+		} else {
+			c = cache_lru.NewLRUCacheWithTTL[K, V](options.Name, options.Capacity, options.TTL)
+		}
+	case PolicyLFU:
+		c = cache_lfu.NewLFUCacheWithTTL[K, V](options.Name, options.Capacity, options.TTL)
+	case PolicyARC:
+		c = cache_arc.NewARCCacheWithTTL[K, V](options.Name, options.Capacity, options.TTL)
+	default:
+		return nil, errors.Wrap(ErrUnknownPolicy, options.Policy)
+	}
+
+	return withJanitor[K, V](ctx, wg, options, c), nil
+}
+
+// Оборачивает кэш метриками и запускает удаление протухших элементов
+func withJanitor[K comparable, V any](ctx context.Context, wg *sync.WaitGroup,
+	options Options, c cache.Cache[K, V]) cache.Cache[K, V] {
+
+	interval := options.JanitorInterval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	instrumented := cache.WithMetrics(c)
+	cache.RunJanitor(ctx, wg, interval, instrumented.DeleteExpired)
+
+	return instrumented
+}
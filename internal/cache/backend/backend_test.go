@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_arc"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lfu"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// политика из конфига выбирает реализацию кэша
+func TestNew_Policy_SelectsImplementation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	for _, tc := range []struct {
+		policy   string
+		shards   int
+		expected interface{}
+	}{
+		{"", 0, &cache_lru.LRUCache[string, int]{}},
+		{PolicyLRU, 1, &cache_lru.LRUCache[string, int]{}},
+		{PolicyLRU, 4, &cache_lru.ShardedLRUCache[string, int]{}},
+		{PolicyLFU, 0, &cache_lfu.LFUCache[string, int]{}},
+		{PolicyARC, 0, &cache_arc.ARCCache[string, int]{}},
+	} {
+		c, err := New[string, int](ctx, &wg, Options{
+			Name:     "test",
+			Policy:   tc.policy,
+			Capacity: 10,
+			Shards:   tc.shards,
+		}, cache_lru.HashString)
+
+		require.NoError(t, err, tc.policy)
+		if assert.IsType(t, &cache.MetricsCache[string, int]{}, c, tc.policy) {
+			assert.IsType(t, tc.expected, c.(*cache.MetricsCache[string, int]).Unwrap(), tc.policy)
+		}
+		c.Add("one", 1)
+		value, err := c.Get("one")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, value)
+	}
+}
+
+// неизвестная политика и шарды не для lru - ошибка конфига
+func TestNew_InvalidOptions_ReturnError(t *testing.T) {
+	var wg sync.WaitGroup
+
+	_, err := New[string, int](context.Background(), &wg, Options{Policy: "mru"}, cache_lru.HashString)
+	assert.ErrorIs(t, err, ErrUnknownPolicy)
+
+	_, err = New[string, int](context.Background(), &wg, Options{Policy: PolicyARC, Shards: 2}, cache_lru.HashString)
+	assert.ErrorIs(t, err, ErrShardsNotSupported)
+}
+
+// с настройками redis кэш хранится в redis, политика только lru
+func TestNew_Redis_SelectsRedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	redisOptions := &cache_redis.Options{Addr: server.Addr()}
+
+	c, err := New[string, int](ctx, &wg, Options{Name: "test", Capacity: 10, Redis: redisOptions},
+		cache_lru.HashString)
+	require.NoError(t, err)
+	_, err = New[string, int](ctx, &wg, Options{Policy: PolicyLFU, Redis: redisOptions}, cache_lru.HashString)
+	assert.ErrorIs(t, err, ErrRedisPolicy)
+
+	if assert.IsType(t, &cache.MetricsCache[string, int]{}, c) {
+		assert.IsType(t, &cache_redis.RedisCache[string, int]{}, c.(*cache.MetricsCache[string, int]).Unwrap())
+	}
+	c.Add("one", 1)
+	value, err := c.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, []string{"gospend:test:one"}, server.Keys())
+}
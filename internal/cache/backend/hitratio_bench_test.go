@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Доля попаданий политик на синтетической трассе запросов рапортов:
+// популярность юзеров распределена по Ципфу, а время от времени
+// идет проход по редким юзерам, которые больше не возвращаются.
+// go test -run '^$' -bench HitRatio ./internal/cache/backend
+
+const (
+	traceUsers    = 5000
+	traceLength   = 100000
+	traceCapacity = 250
+	scanEvery     = 5000
+	scanLength    = 500
+)
+
+func syntheticTrace() []string {
+	rnd := rand.New(rand.NewSource(42))
+	zipf := rand.NewZipf(rnd, 1.1, 1, traceUsers-1)
+	periods := []string{"W", "M", "Y"}
+
+	trace := make([]string, 0, traceLength)
+	scanned := 0
+	for len(trace) < traceLength {
+		if len(trace)%scanEvery == 0 {
+			for i := 0; i < scanLength; i++ {
+				trace = append(trace, "scan"+strconv.Itoa(scanned)+"_M")
+				scanned++
+			}
+		}
+		user := zipf.Uint64()
+		trace = append(trace, strconv.FormatUint(user, 10)+"_"+periods[rnd.Intn(len(periods))])
+	}
+	return trace
+}
+
+func benchmarkHitRatio(b *testing.B, policy string) {
+	trace := syntheticTrace()
+	var hits, requests int
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		c, err := New[string, struct{}](ctx, &wg, Options{
+			Name:     "bench_" + policy,
+			Policy:   policy,
+			Capacity: traceCapacity,
+		}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, key := range trace {
+			requests++
+			if _, err := c.Get(key); err == nil {
+				hits++
+			} else {
+				c.Add(key, struct{}{})
+			}
+		}
+
+		cancel()
+		wg.Wait()
+	}
+
+	b.ReportMetric(100*float64(hits)/float64(requests), "hit%")
+}
+
+func BenchmarkHitRatio_LRU(b *testing.B) {
+	benchmarkHitRatio(b, PolicyLRU)
+}
+
+func BenchmarkHitRatio_LFU(b *testing.B) {
+	benchmarkHitRatio(b, PolicyLFU)
+}
+
+func BenchmarkHitRatio_ARC(b *testing.B) {
+	benchmarkHitRatio(b, PolicyARC)
+}
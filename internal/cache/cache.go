@@ -1,15 +1,25 @@
 package cache
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrElementNotInCache = errors.New("element not in cache")
+	// ErrElementExpired - элемент был в кэше, но протух, errors.Is(err, ErrElementNotInCache) верно
+	ErrElementExpired = fmt.Errorf("%w: expired", ErrElementNotInCache)
 )
 
-type Storager interface {
+// Cache - типизированный кэш значений V по ключам K
+type Cache[K comparable, V any] interface {
 	Name() string
-	Add(key string, value interface{}) bool
-	Get(key string) (interface{}, error)
+	// Add добавляет значение со сроком жизни кэша по умолчанию
+	Add(key K, value V) bool
+	// AddWithTTL добавляет значение, которое протухает через ttl, 0 - бессрочно
+	AddWithTTL(key K, value V, ttl time.Duration) bool
+	Get(key K) (V, error)
 	Len() int
-	Delete(key string) error
+	Delete(key K) error
 }
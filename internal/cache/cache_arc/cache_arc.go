@@ -0,0 +1,250 @@
+package cache_arc
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+)
+
+// Части кэша ARC: t1 - элементы, запрошенные один раз, t2 - запрошенные повторно,
+// b1 и b2 - "призраки", ключи недавно вытесненных из t1 и t2 элементов без значений
+type segment int
+
+const (
+	t1 segment = iota
+	t2
+	b1
+	b2
+)
+
+// ARCCache - Adaptive Replacement Cache (Megiddo, Modha).
+// Кэш сам подбирает p - целевой размер t1: попадание в призрак b1 говорит,
+// что недавним элементам не хватает места, и увеличивает p, попадание в b2 - уменьшает.
+// Поэтому кэш устойчив к однократным проходам по многим ключам и
+// удерживает часто запрашиваемые элементы, как LFU
+type ARCCache[K comparable, V any] struct {
+	name       string
+	values     map[K]*list.Element
+	lists      [4]list.List
+	p          int
+	capacity   int
+	defaultTTL time.Duration
+	now        func() time.Time
+	sync.Mutex
+}
+
+var _ cache.Cache[string, interface{}] = (*ARCCache[string, interface{}])(nil)
+
+type Item[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+	segment   segment
+}
+
+func NewARCCache[K comparable, V any](name string, capacity int) *ARCCache[K, V] {
+	return NewARCCacheWithTTL[K, V](name, capacity, 0)
+}
+
+// NewARCCacheWithTTL создает кэш, в котором Add добавляет элементы со сроком жизни defaultTTL
+func NewARCCacheWithTTL[K comparable, V any](name string, capacity int, defaultTTL time.Duration) *ARCCache[K, V] {
+	return &ARCCache[K, V]{
+		name:       name,
+		values:     make(map[K]*list.Element, 2*capacity),
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		now:        time.Now,
+	}
+}
+
+func (arc *ARCCache[K, V]) Name() string {
+	return arc.name
+}
+
+func (arc *ARCCache[K, V]) Add(key K, value V) bool {
+	return arc.AddWithTTL(key, value, arc.defaultTTL)
+}
+
+func (arc *ARCCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) (eviction bool) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	expiresAt := cache.ExpiresAt(arc.now(), ttl)
+
+	element, known := arc.values[key]
+	if known {
+		item := element.Value.(*Item[K, V])
+		switch item.segment {
+		case t1, t2:
+			item.value = value
+			item.expiresAt = expiresAt
+			arc.move(element, t2)
+			return false
+		case b1:
+			arc.p = min(arc.capacity, arc.p+max(arc.lists[b2].Len()/arc.lists[b1].Len(), 1))
+		case b2:
+			arc.p = max(0, arc.p-max(arc.lists[b1].Len()/arc.lists[b2].Len(), 1))
+		}
+
+		// Призрак возвращается в кэш сразу в t2
+		eviction = arc.replace(item.segment == b2)
+		item.value = value
+		item.expiresAt = expiresAt
+		arc.move(element, t2)
+		return eviction
+	}
+
+	resident := arc.lists[t1].Len() + arc.lists[t2].Len()
+	if arc.lists[t1].Len()+arc.lists[b1].Len() >= arc.capacity {
+		if arc.lists[t1].Len() < arc.capacity {
+			arc.removeElement(arc.lists[b1].Back())
+			eviction = arc.replace(false)
+		} else {
+			arc.removeElement(arc.lists[t1].Back())
+			eviction = true
+		}
+	} else if resident+arc.lists[b1].Len()+arc.lists[b2].Len() >= arc.capacity {
+		if resident+arc.lists[b1].Len()+arc.lists[b2].Len() >= 2*arc.capacity {
+			arc.removeElement(arc.lists[b2].Back())
+		}
+		eviction = arc.replace(false)
+	}
+
+	item := &Item[K, V]{key: key, value: value, expiresAt: expiresAt, segment: t1}
+	arc.values[key] = arc.lists[t1].PushFront(item)
+
+	return eviction
+}
+
+func (arc *ARCCache[K, V]) Get(key K) (V, error) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	var zero V
+	element, known := arc.values[key]
+	if !known {
+		return zero, cache.ErrElementNotInCache
+	}
+
+	item := element.Value.(*Item[K, V])
+	if item.segment == b1 || item.segment == b2 {
+		return zero, cache.ErrElementNotInCache
+	}
+	if cache.Expired(item.expiresAt, arc.now()) {
+		arc.removeElement(element)
+		return zero, cache.ErrElementExpired
+	}
+
+	arc.move(element, t2)
+	return item.value, nil
+}
+
+// Len - количество элементов со значениями, призраки не считаются
+func (arc *ARCCache[K, V]) Len() int {
+	arc.Lock()
+	defer arc.Unlock()
+
+	return arc.lists[t1].Len() + arc.lists[t2].Len()
+}
+
+func (arc *ARCCache[K, V]) Delete(key K) error {
+	arc.Lock()
+	defer arc.Unlock()
+
+	element, known := arc.values[key]
+	if !known {
+		return cache.ErrElementNotInCache
+	}
+
+	resident := arc.isResident(element)
+	arc.removeElement(element)
+	if !resident {
+		return cache.ErrElementNotInCache
+	}
+	return nil
+}
+
+// DeleteExpired удаляет все протухшие элементы и возвращает их количество
+func (arc *ARCCache[K, V]) DeleteExpired() int {
+	arc.Lock()
+	defer arc.Unlock()
+
+	now := arc.now()
+	var count int
+	for _, seg := range []segment{t1, t2} {
+		for element := arc.lists[seg].Front(); element != nil; {
+			next := element.Next()
+			if cache.Expired(element.Value.(*Item[K, V]).expiresAt, now) {
+				arc.removeElement(element)
+				count++
+			}
+			element = next
+		}
+	}
+	return count
+}
+
+// RunJanitor раз в interval удаляет протухшие элементы, пока не отменен ctx
+func (arc *ARCCache[K, V]) RunJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	cache.RunJanitor(ctx, wg, interval, arc.DeleteExpired)
+}
+
+// Освобождение места под новый элемент: самый старый элемент t1 или t2
+// становится призраком в b1 или b2. Пока кэш не заполнен, ничего не вытесняется
+func (arc *ARCCache[K, V]) replace(inB2 bool) bool {
+	if arc.lists[t1].Len()+arc.lists[t2].Len() < arc.capacity {
+		return false
+	}
+
+	t1Len := arc.lists[t1].Len()
+	if t1Len > 0 && (t1Len > arc.p || (inB2 && t1Len == arc.p) || arc.lists[t2].Len() == 0) {
+		arc.toGhost(arc.lists[t1].Back(), b1)
+	} else {
+		arc.toGhost(arc.lists[t2].Back(), b2)
+	}
+	return true
+}
+
+func (arc *ARCCache[K, V]) toGhost(element *list.Element, ghost segment) {
+	item := element.Value.(*Item[K, V])
+	var zero V
+	item.value = zero
+	item.expiresAt = time.Time{}
+	arc.move(element, ghost)
+}
+
+// Перенос элемента в начало списка seg
+func (arc *ARCCache[K, V]) move(element *list.Element, seg segment) {
+	item := element.Value.(*Item[K, V])
+	arc.lists[item.segment].Remove(element)
+	item.segment = seg
+	arc.values[item.key] = arc.lists[seg].PushFront(item)
+}
+
+func (arc *ARCCache[K, V]) isResident(element *list.Element) bool {
+	seg := element.Value.(*Item[K, V]).segment
+	return seg == t1 || seg == t2
+}
+
+func (arc *ARCCache[K, V]) removeElement(element *list.Element) {
+	item := element.Value.(*Item[K, V])
+	arc.lists[item.segment].Remove(element)
+	delete(arc.values, item.key)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
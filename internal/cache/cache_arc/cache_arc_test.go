@@ -0,0 +1,207 @@
+package cache_arc
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// новые элементы попадают в t1, повторно запрошенные - в t2
+func TestARCCache_Get_ExistElement_MovedToT2(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[string, int]("", 3)
+	arc.Add("one", 1)
+	arc.Add("two", 2)
+
+	// Act
+	value, err := arc.Get("one")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	checkSegment(t, arc, "one", t2)
+	checkSegment(t, arc, "two", t1)
+	assert.Equal(t, arc.Len(), 2)
+}
+
+// однократный проход по многим ключам не вытесняет повторно запрошенные элементы
+func TestARCCache_Add_Scan_FrequentElementsKept(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[string, int]("", 4)
+	arc.Add("one", 1)
+	arc.Add("two", 2)
+	_, _ = arc.Get("one")
+	_, _ = arc.Get("two")
+
+	// Act
+	var evictions int
+	for i := 0; i < 20; i++ {
+		if arc.Add("scan"+strconv.Itoa(i), i) {
+			evictions++
+		}
+	}
+
+	// Assert
+	assert.Equal(t, 18, evictions)
+	for key, expected := range map[string]int{"one": 1, "two": 2} {
+		value, err := arc.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+	assert.Equal(t, arc.Len(), 4)
+	checkInvariants(t, arc)
+}
+
+// вытесненный элемент остается призраком, его возврат увеличивает место для t1
+func TestARCCache_Add_GhostB1Hit_ReturnedToT2AndTargetGrows(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[string, int]("", 2)
+	arc.Add("one", 1)
+	_, _ = arc.Get("one")
+	arc.Add("two", 2)
+	arc.Add("three", 3)
+	checkSegment(t, arc, "two", b1)
+	_, err := arc.Get("two")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+
+	// Act
+	eviction := arc.Add("two", 22)
+
+	// Assert
+	assert.True(t, eviction)
+	assert.Equal(t, 1, arc.p)
+	checkSegment(t, arc, "two", t2)
+	value, err := arc.Get("two")
+	assert.NoError(t, err)
+	assert.Equal(t, 22, value)
+	assert.Equal(t, arc.Len(), 2)
+	checkInvariants(t, arc)
+}
+
+// удаление элемента и призрака
+func TestARCCache_Delete_ElementAndGhost(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[string, int]("", 2)
+	arc.Add("one", 1)
+	_, _ = arc.Get("one")
+	arc.Add("two", 2)
+	arc.Add("three", 3)
+	checkSegment(t, arc, "two", b1)
+
+	// Act
+	errT1 := arc.Delete("three")
+	errT2 := arc.Delete("one")
+	errGhost := arc.Delete("two")
+	errMissing := arc.Delete("four")
+
+	// Assert
+	assert.NoError(t, errT1)
+	assert.NoError(t, errT2)
+	assert.ErrorIs(t, errGhost, cache.ErrElementNotInCache)
+	assert.ErrorIs(t, errMissing, cache.ErrElementNotInCache)
+	assert.Empty(t, arc.values)
+	assert.Equal(t, arc.Len(), 0)
+}
+
+// протухшие элементы удаляются без перехода в призраки
+func TestARCCache_Expired_Elements_Removed(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	arc := NewARCCacheWithTTL[string, int]("", 3, time.Minute)
+	arc.now = func() time.Time { return now }
+	arc.Add("one", 1)
+	arc.Add("two", 2)
+	_, _ = arc.Get("two")
+	arc.AddWithTTL("three", 3, 0)
+	now = now.Add(time.Minute)
+
+	// Act
+	_, err := arc.Get("one")
+	count := arc.DeleteExpired()
+
+	// Assert
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	assert.Equal(t, 1, count)
+	assert.Len(t, arc.values, 1)
+	checkSegment(t, arc, "three", t1)
+}
+
+// случайная последовательность операций сохраняет размеры списков ARC
+func TestARCCache_RandomOperations_InvariantsKept(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[int, int]("", 8)
+	rnd := rand.New(rand.NewSource(1))
+
+	// Act
+	for i := 0; i < 5000; i++ {
+		key := rnd.Intn(30)
+		switch rnd.Intn(10) {
+		case 0:
+			_ = arc.Delete(key)
+		default:
+			if _, err := arc.Get(key); err != nil {
+				arc.Add(key, key)
+			}
+		}
+
+		// Assert
+		checkInvariants(t, arc)
+	}
+}
+
+// одновременные операции, запускается с go test -race
+func TestARCCache_MixedOperationsSync_CapacityKept(t *testing.T) {
+	// Arrange
+	arc := NewARCCache[string, int]("", 16)
+
+	// Act
+	var wg sync.WaitGroup
+	wg.Add(8)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 300; j++ {
+				key := strconv.Itoa((i * j) % 40)
+				if _, err := arc.Get(key); err != nil {
+					arc.Add(key, j)
+				}
+				if j%11 == 0 {
+					_ = arc.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.LessOrEqual(t, arc.Len(), 16)
+	checkInvariants(t, arc)
+}
+
+// helpers
+
+func checkSegment[K comparable, V any](t testing.TB, arc *ARCCache[K, V], key K, expected segment) {
+	t.Helper()
+	element, inMap := arc.values[key]
+	if assert.True(t, inMap) {
+		assert.Equal(t, expected, element.Value.(*Item[K, V]).segment)
+	}
+}
+
+func checkInvariants[K comparable, V any](t testing.TB, arc *ARCCache[K, V]) {
+	t.Helper()
+	c := arc.capacity
+	l1 := arc.lists[t1].Len() + arc.lists[b1].Len()
+	total := l1 + arc.lists[t2].Len() + arc.lists[b2].Len()
+	assert.LessOrEqual(t, arc.lists[t1].Len()+arc.lists[t2].Len(), c)
+	assert.LessOrEqual(t, l1, c)
+	assert.LessOrEqual(t, total, 2*c)
+	assert.Equal(t, len(arc.values), total)
+	assert.GreaterOrEqual(t, arc.p, 0)
+	assert.LessOrEqual(t, arc.p, c)
+}
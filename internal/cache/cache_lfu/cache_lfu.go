@@ -0,0 +1,185 @@
+package cache_lfu
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+)
+
+// LFUCache вытесняет элемент с наименьшим числом обращений,
+// среди равных по частоте - самый давно использованный.
+// Элементы с одинаковой частотой лежат в одной очереди, поэтому все операции O(1)
+type LFUCache[K comparable, V any] struct {
+	name       string
+	values     map[K]*list.Element
+	freqs      map[int]*list.List
+	minFreq    int
+	capacity   int
+	defaultTTL time.Duration
+	now        func() time.Time
+	sync.Mutex
+}
+
+var _ cache.Cache[string, interface{}] = (*LFUCache[string, interface{}])(nil)
+
+type Item[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+	freq      int
+}
+
+func NewLFUCache[K comparable, V any](name string, capacity int) *LFUCache[K, V] {
+	return NewLFUCacheWithTTL[K, V](name, capacity, 0)
+}
+
+// NewLFUCacheWithTTL создает кэш, в котором Add добавляет элементы со сроком жизни defaultTTL
+func NewLFUCacheWithTTL[K comparable, V any](name string, capacity int, defaultTTL time.Duration) *LFUCache[K, V] {
+	return &LFUCache[K, V]{
+		name:       name,
+		values:     make(map[K]*list.Element, capacity),
+		freqs:      make(map[int]*list.List),
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		now:        time.Now,
+	}
+}
+
+func (lfu *LFUCache[K, V]) Name() string {
+	return lfu.name
+}
+
+func (lfu *LFUCache[K, V]) Add(key K, value V) bool {
+	return lfu.AddWithTTL(key, value, lfu.defaultTTL)
+}
+
+// AddWithTTL для существующего ключа обновляет значение и считает обращение
+func (lfu *LFUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) (eviction bool) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	expiresAt := cache.ExpiresAt(lfu.now(), ttl)
+
+	if element, inCache := lfu.values[key]; inCache {
+		item := element.Value.(*Item[K, V])
+		item.value = value
+		item.expiresAt = expiresAt
+		lfu.touch(element)
+		return false
+	}
+
+	if len(lfu.values) == lfu.capacity {
+		eviction = true
+		lfu.removeElement(lfu.leastFrequent())
+	}
+	lfu.values[key] = lfu.queue(1).PushFront(&Item[K, V]{key: key, value: value, expiresAt: expiresAt, freq: 1})
+	lfu.minFreq = 1
+
+	return eviction
+}
+
+func (lfu *LFUCache[K, V]) Get(key K) (V, error) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	var zero V
+	element, inCache := lfu.values[key]
+	if !inCache {
+		return zero, cache.ErrElementNotInCache
+	}
+
+	item := element.Value.(*Item[K, V])
+	if cache.Expired(item.expiresAt, lfu.now()) {
+		lfu.removeElement(element)
+		return zero, cache.ErrElementExpired
+	}
+
+	lfu.touch(element)
+	return item.value, nil
+}
+
+func (lfu *LFUCache[K, V]) Len() int {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	return len(lfu.values)
+}
+
+func (lfu *LFUCache[K, V]) Delete(key K) error {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	element, inCache := lfu.values[key]
+	if !inCache {
+		return cache.ErrElementNotInCache
+	}
+	lfu.removeElement(element)
+	return nil
+}
+
+// DeleteExpired удаляет все протухшие элементы и возвращает их количество
+func (lfu *LFUCache[K, V]) DeleteExpired() int {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	now := lfu.now()
+	var count int
+	for _, element := range lfu.values {
+		if cache.Expired(element.Value.(*Item[K, V]).expiresAt, now) {
+			lfu.removeElement(element)
+			count++
+		}
+	}
+	return count
+}
+
+// RunJanitor раз в interval удаляет протухшие элементы, пока не отменен ctx
+func (lfu *LFUCache[K, V]) RunJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	cache.RunJanitor(ctx, wg, interval, lfu.DeleteExpired)
+}
+
+// Очередь элементов с частотой freq, создается при первом обращении
+func (lfu *LFUCache[K, V]) queue(freq int) *list.List {
+	queue, ok := lfu.freqs[freq]
+	if !ok {
+		queue = list.New()
+		lfu.freqs[freq] = queue
+	}
+	return queue
+}
+
+// Перенос элемента в очередь со следующей частотой
+func (lfu *LFUCache[K, V]) touch(element *list.Element) {
+	item := element.Value.(*Item[K, V])
+	lfu.unlink(element)
+	if item.freq == lfu.minFreq && lfu.freqs[item.freq] == nil {
+		lfu.minFreq++
+	}
+	item.freq++
+	lfu.values[item.key] = lfu.queue(item.freq).PushFront(item)
+}
+
+// Самый давно использованный элемент с наименьшей частотой.
+// После удалений minFreq может указывать на пустую очередь, но кэш тогда неполон,
+// а вставка нового элемента перед вытеснением снова выставляет minFreq в 1
+func (lfu *LFUCache[K, V]) leastFrequent() *list.Element {
+	return lfu.freqs[lfu.minFreq].Back()
+}
+
+func (lfu *LFUCache[K, V]) removeElement(element *list.Element) {
+	lfu.unlink(element)
+	delete(lfu.values, element.Value.(*Item[K, V]).key)
+}
+
+// Удаление элемента из очереди его частоты, пустая очередь удаляется
+func (lfu *LFUCache[K, V]) unlink(element *list.Element) {
+	freq := element.Value.(*Item[K, V]).freq
+	queue := lfu.freqs[freq]
+	queue.Remove(element)
+	if queue.Len() == 0 {
+		delete(lfu.freqs, freq)
+	}
+}
@@ -0,0 +1,175 @@
+package cache_lfu
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// вставка в полный кэш вытесняет самый редко запрашиваемый элемент
+func TestLFUCache_Add_FullCache_LeastFrequentRemoved(t *testing.T) {
+	// Arrange
+	lfu := NewLFUCache[string, int]("", 3)
+	lfu.Add("one", 1)
+	lfu.Add("two", 2)
+	lfu.Add("three", 3)
+	_, _ = lfu.Get("one")
+	_, _ = lfu.Get("one")
+	_, _ = lfu.Get("three")
+
+	// Act
+	eviction := lfu.Add("four", 4)
+
+	// Assert
+	assert.True(t, eviction)
+	_, err := lfu.Get("two")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	checkFreq(t, lfu, "one", 3)
+	checkFreq(t, lfu, "three", 2)
+	checkFreq(t, lfu, "four", 1)
+	assert.Equal(t, lfu.Len(), 3)
+}
+
+// среди элементов с одинаковой частотой вытесняется самый давно использованный
+func TestLFUCache_Add_EqualFrequency_LeastRecentRemoved(t *testing.T) {
+	// Arrange
+	lfu := NewLFUCache[string, int]("", 2)
+	lfu.Add("one", 1)
+	lfu.Add("two", 2)
+	_, _ = lfu.Get("one")
+	_, _ = lfu.Get("two")
+
+	// Act
+	eviction := lfu.Add("three", 3)
+
+	// Assert
+	assert.True(t, eviction)
+	_, err := lfu.Get("one")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	value, err := lfu.Get("two")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, value)
+}
+
+// повторная вставка обновляет значение и считается обращением
+func TestLFUCache_Add_AddExistElement_NewValueAndFrequency(t *testing.T) {
+	// Arrange
+	lfu := NewLFUCache[string, int]("", 2)
+	lfu.Add("one", 1)
+	lfu.Add("two", 2)
+
+	// Act
+	eviction := lfu.Add("one", 10)
+	lfu.Add("three", 3)
+
+	// Assert
+	assert.False(t, eviction)
+	checkFreq(t, lfu, "one", 2)
+	value, err := lfu.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, value)
+	_, err = lfu.Get("two")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+}
+
+// после удаления элемента вытесняется наименее частый из оставшихся
+func TestLFUCache_Delete_MinFrequencyElement_NextLeastFrequentRemoved(t *testing.T) {
+	// Arrange
+	lfu := NewLFUCache[string, int]("", 2)
+	lfu.Add("one", 1)
+	lfu.Add("two", 2)
+	_, _ = lfu.Get("one")
+	_, _ = lfu.Get("two")
+	_, _ = lfu.Get("two")
+	lfu.Add("three", 3)
+	_ = lfu.Delete("three")
+	lfu.Add("three", 3)
+	_, _ = lfu.Get("three")
+	_, _ = lfu.Get("three")
+	_, _ = lfu.Get("three")
+
+	// Act
+	err := lfu.Delete("missing")
+	eviction := lfu.Add("four", 4)
+
+	// Assert
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	assert.True(t, eviction)
+	_, err = lfu.Get("two")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	checkFreq(t, lfu, "three", 4)
+	checkFreq(t, lfu, "four", 1)
+}
+
+// протухшие элементы не возвращаются и удаляются
+func TestLFUCache_Expired_Elements_Removed(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lfu := NewLFUCacheWithTTL[string, int]("", 3, time.Minute)
+	lfu.now = func() time.Time { return now }
+	lfu.Add("one", 1)
+	lfu.Add("two", 2)
+	lfu.AddWithTTL("three", 3, 0)
+	now = now.Add(time.Minute)
+
+	// Act
+	_, err := lfu.Get("one")
+	count := lfu.DeleteExpired()
+
+	// Assert
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	assert.Equal(t, 1, count)
+	checkFreq(t, lfu, "three", 1)
+	assert.Equal(t, lfu.Len(), 1)
+}
+
+// одновременные операции, запускается с go test -race
+func TestLFUCache_MixedOperationsSync_CapacityKept(t *testing.T) {
+	// Arrange
+	lfu := NewLFUCache[string, int]("", 16)
+
+	// Act
+	var wg sync.WaitGroup
+	wg.Add(8)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 300; j++ {
+				key := strconv.Itoa((i * j) % 40)
+				if _, err := lfu.Get(key); err != nil {
+					lfu.Add(key, j)
+				}
+				if j%11 == 0 {
+					_ = lfu.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	assert.LessOrEqual(t, lfu.Len(), 16)
+	var queued int
+	for freq, queue := range lfu.freqs {
+		assert.NotZero(t, queue.Len())
+		for element := queue.Front(); element != nil; element = element.Next() {
+			assert.Equal(t, freq, element.Value.(*Item[string, int]).freq)
+			queued++
+		}
+	}
+	assert.Equal(t, len(lfu.values), queued)
+}
+
+// helpers
+
+func checkFreq(t testing.TB, lfu *LFUCache[string, int], key string, expected int) {
+	t.Helper()
+	element, inMap := lfu.values[key]
+	if assert.True(t, inMap) {
+		assert.Equal(t, expected, element.Value.(*Item[string, int]).freq)
+	}
+}
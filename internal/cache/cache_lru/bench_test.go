@@ -0,0 +1,55 @@
+package cache_lru
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+)
+
+// go test -bench . -cpu 1,4,8 ./internal/cache/cache_lru
+
+const (
+	benchCapacity = 1024
+	benchKeys     = 4096
+	benchShards   = 16
+)
+
+func benchmarkParallel(b *testing.B, c cache.Cache[string, int], writeEvery int) {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Add(keys[i], i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		for i := 0; pb.Next(); i++ {
+			n := rnd.Intn(benchKeys)
+			if i%writeEvery == 0 {
+				c.Add(keys[n], n)
+			} else {
+				_, _ = c.Get(keys[n])
+			}
+		}
+	})
+}
+
+func BenchmarkLRUCache_ReadHeavy(b *testing.B) {
+	benchmarkParallel(b, NewLRUCache[string, int]("bench", benchCapacity), 10)
+}
+
+func BenchmarkShardedLRUCache_ReadHeavy(b *testing.B) {
+	benchmarkParallel(b, NewShardedLRUCache[string, int]("bench", benchCapacity, benchShards, HashString), 10)
+}
+
+func BenchmarkLRUCache_WriteHeavy(b *testing.B) {
+	benchmarkParallel(b, NewLRUCache[string, int]("bench", benchCapacity), 2)
+}
+
+func BenchmarkShardedLRUCache_WriteHeavy(b *testing.B) {
+	benchmarkParallel(b, NewShardedLRUCache[string, int]("bench", benchCapacity, benchShards, HashString), 2)
+}
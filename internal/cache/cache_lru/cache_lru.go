@@ -2,86 +2,145 @@ package cache_lru
 
 import (
 	"container/list"
+	"context"
 	"sync"
+	"time"
 
 	"github.com/cr00z/goSpendingBot/internal/cache"
 )
 
-type LRUCache struct {
-	name     string
-	values   map[string]*list.Element
-	queue    list.List
-	capacity int
+type LRUCache[K comparable, V any] struct {
+	name       string
+	values     map[K]*list.Element
+	queue      list.List
+	capacity   int
+	defaultTTL time.Duration
+	now        func() time.Time
 	sync.RWMutex
 }
 
-type Item struct {
-	key   string
-	value interface{}
+var _ cache.Cache[string, interface{}] = (*LRUCache[string, interface{}])(nil)
+
+type Item[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func (item *Item[K, V]) expired(now time.Time) bool {
+	return cache.Expired(item.expiresAt, now)
 }
 
-func NewLRUCache(name string, capacity int) *LRUCache {
-	return &LRUCache{
-		name:     name,
-		values:   make(map[string]*list.Element, capacity),
-		queue:    list.List{},
-		capacity: capacity,
+func NewLRUCache[K comparable, V any](name string, capacity int) *LRUCache[K, V] {
+	return NewLRUCacheWithTTL[K, V](name, capacity, 0)
+}
+
+// NewLRUCacheWithTTL создает кэш, в котором Add добавляет элементы со сроком жизни defaultTTL
+func NewLRUCacheWithTTL[K comparable, V any](name string, capacity int, defaultTTL time.Duration) *LRUCache[K, V] {
+	return &LRUCache[K, V]{
+		name:       name,
+		values:     make(map[K]*list.Element, capacity),
+		queue:      list.List{},
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		now:        time.Now,
 	}
 }
 
-func (lru *LRUCache) Name() string {
+func (lru *LRUCache[K, V]) Name() string {
 	return lru.name
 }
 
-func (lru *LRUCache) Add(key string, value interface{}) (eviction bool) {
+func (lru *LRUCache[K, V]) Add(key K, value V) (eviction bool) {
+	return lru.AddWithTTL(key, value, lru.defaultTTL)
+}
+
+func (lru *LRUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) (eviction bool) {
 	lru.RWMutex.Lock()
 	defer lru.RWMutex.Unlock()
 
+	expiresAt := cache.ExpiresAt(lru.now(), ttl)
+
 	if element, inCache := lru.values[key]; inCache {
-		element.Value.(*Item).value = value
+		item := element.Value.(*Item[K, V])
+		item.value = value
+		item.expiresAt = expiresAt
 		lru.queue.MoveToFront(element)
 	} else {
 		if len(lru.values) == lru.capacity {
 			eviction = true
-			removeElement := lru.queue.Back()
-			removeItem := lru.queue.Remove(removeElement).(*Item)
-			delete(lru.values, removeItem.key)
+			lru.removeElement(lru.queue.Back())
 		}
-		lru.values[key] = lru.queue.PushFront(&Item{key, value})
+		lru.values[key] = lru.queue.PushFront(&Item[K, V]{key, value, expiresAt})
 	}
 
 	return eviction
 }
 
-func (lru *LRUCache) Get(key string) (interface{}, error) {
-	lru.RWMutex.RLock()
-	defer lru.RWMutex.RUnlock()
+// Get перемещает элемент в начало очереди, поэтому берет блокировку на запись
+func (lru *LRUCache[K, V]) Get(key K) (V, error) {
+	lru.RWMutex.Lock()
+	defer lru.RWMutex.Unlock()
 
-	if value, inCache := lru.values[key]; inCache {
-		lru.queue.MoveToFront(value)
-		return value.Value.(*Item).value, nil
-	} else {
-		return nil, cache.ErrElementNotInCache
+	var zero V
+	element, inCache := lru.values[key]
+	if !inCache {
+		return zero, cache.ErrElementNotInCache
 	}
 
+	item := element.Value.(*Item[K, V])
+	if item.expired(lru.now()) {
+		lru.removeElement(element)
+		return zero, cache.ErrElementExpired
+	}
+
+	lru.queue.MoveToFront(element)
+	return item.value, nil
 }
 
-func (lru *LRUCache) Len() int {
+func (lru *LRUCache[K, V]) Len() int {
 	lru.RWMutex.RLock()
 	defer lru.RWMutex.RUnlock()
 
 	return len(lru.values)
 }
 
-func (lru *LRUCache) Delete(key string) error {
+func (lru *LRUCache[K, V]) Delete(key K) error {
 	lru.RWMutex.Lock()
 	defer lru.RWMutex.Unlock()
 
 	if value, inCache := lru.values[key]; inCache {
-		delete(lru.values, value.Value.(*Item).key)
-		lru.queue.Remove(value)
+		lru.removeElement(value)
 		return nil
 	} else {
 		return cache.ErrElementNotInCache
 	}
 }
+
+// DeleteExpired удаляет все протухшие элементы и возвращает их количество
+func (lru *LRUCache[K, V]) DeleteExpired() int {
+	lru.RWMutex.Lock()
+	defer lru.RWMutex.Unlock()
+
+	now := lru.now()
+	var count int
+	for element := lru.queue.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*Item[K, V]).expired(now) {
+			lru.removeElement(element)
+			count++
+		}
+		element = next
+	}
+	return count
+}
+
+// RunJanitor раз в interval удаляет протухшие элементы, пока не отменен ctx
+func (lru *LRUCache[K, V]) RunJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	cache.RunJanitor(ctx, wg, interval, lru.DeleteExpired)
+}
+
+func (lru *LRUCache[K, V]) removeElement(element *list.Element) {
+	item := lru.queue.Remove(element).(*Item[K, V])
+	delete(lru.values, item.key)
+}
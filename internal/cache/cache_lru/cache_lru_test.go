@@ -2,9 +2,11 @@ package cache_lru
 
 import (
 	"container/list"
+	"context"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/cr00z/goSpendingBot/internal/cache"
 	"github.com/stretchr/testify/assert"
@@ -13,7 +15,7 @@ import (
 // вставка нового элемента в неполный кэш
 func TestLRUCache_Add_AddNewElement_AddedOnFront(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 
@@ -30,7 +32,7 @@ func TestLRUCache_Add_AddNewElement_AddedOnFront(t *testing.T) {
 // вставка нового элемента в полный кэш
 func TestLRUCache_Add_AddNewElementFullCache_AddedAndOldestRemoved(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 	lru.Add("three", 3)
@@ -48,7 +50,7 @@ func TestLRUCache_Add_AddNewElementFullCache_AddedAndOldestRemoved(t *testing.T)
 // вставка существующего элемента в неполный кэш
 func TestLRUCache_Add_AddExistElement_MoveToFrontAndNewValue(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", 2)
 
@@ -64,7 +66,7 @@ func TestLRUCache_Add_AddExistElement_MoveToFrontAndNewValue(t *testing.T) {
 // вставка существующего элемента в полный кэш
 func TestLRUCache_Add_AddExistElementFullCache_MoveToFrontAndNewValue(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]float32{2., 2.})
 	lru.Add("three", 3)
@@ -81,21 +83,21 @@ func TestLRUCache_Add_AddExistElementFullCache_MoveToFrontAndNewValue(t *testing
 // вставка синхронно
 func TestLRUCache_Add_AddElementsSync_AllElementsInCache(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 10)
-	items := []Item{
-		{"1", "1"},
-		{"2", [2]float32{2., 2.}},
-		{"3", "3"},
+	lru := NewLRUCache[string, interface{}]("", 10)
+	items := []Item[string, interface{}]{
+		{key: "1", value: "1"},
+		{key: "2", value: [2]float32{2., 2.}},
+		{key: "3", value: "3"},
 	}
 	for i := 4; i <= 10; i++ {
-		items = append(items, Item{strconv.Itoa(i), i})
+		items = append(items, Item[string, interface{}]{key: strconv.Itoa(i), value: i})
 	}
 
 	// Act
 	var wg sync.WaitGroup
 	wg.Add(len(items))
 	for _, item := range items {
-		go func(item Item) {
+		go func(item Item[string, interface{}]) {
 			lru.Add(item.key, item.value)
 			wg.Done()
 		}(item)
@@ -112,7 +114,7 @@ func TestLRUCache_Add_AddElementsSync_AllElementsInCache(t *testing.T) {
 // получение существующего элемента
 func TestLRUCache_Get_ExistElement_ReturnWithoutError(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 	lru.Add("three", 3)
@@ -131,7 +133,7 @@ func TestLRUCache_Get_ExistElement_ReturnWithoutError(t *testing.T) {
 // получение несуществующего элемента
 func TestLRUCache_Get_MissingElement_ReturnError(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 	lru.Add("three", 3)
@@ -149,10 +151,39 @@ func TestLRUCache_Get_MissingElement_ReturnError(t *testing.T) {
 	assert.Equal(t, lru.Len(), 3)
 }
 
+// получение синхронно, go test -race проверяет перемещение в очереди под блокировкой
+func TestLRUCache_Get_GetElementsSync_QueueConsistent(t *testing.T) {
+	// Arrange
+	lru := NewLRUCache[string, interface{}]("", 10)
+	for i := 1; i <= 10; i++ {
+		lru.Add(strconv.Itoa(i), i)
+	}
+
+	// Act
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 1; i <= 10; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = lru.Get(strconv.Itoa((i+j)%10 + 1))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	for i := 1; i <= 10; i++ {
+		checkElement(t, lru, "random", strconv.Itoa(i), i)
+	}
+	assert.Equal(t, lru.queue.Len(), 10)
+	assert.Equal(t, lru.Len(), 10)
+}
+
 // удаление существующего элемента
 func TestLRUCache_Delete_ExistElement_RemovedAndReturnWithoutError(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 	lru.Add("three", 3)
@@ -170,7 +201,7 @@ func TestLRUCache_Delete_ExistElement_RemovedAndReturnWithoutError(t *testing.T)
 // удаление несуществующего элемента
 func TestLRUCache_Delete_MissingElement_ReturnError(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 3)
+	lru := NewLRUCache[string, interface{}]("", 3)
 	lru.Add("one", "1")
 	lru.Add("two", [2]int{2, 2})
 	lru.Add("three", 3)
@@ -190,15 +221,15 @@ func TestLRUCache_Delete_MissingElement_ReturnError(t *testing.T) {
 // удаление синхронно
 func TestLRUCache_Delete_DeleteElementsSync_NoExtraElementsInCache(t *testing.T) {
 	// Arrange
-	lru := NewLRUCache("", 10)
+	lru := NewLRUCache[string, interface{}]("", 10)
 
-	items := []Item{
-		{"1", "1"},
-		{"2", [2]float32{2., 2.}},
-		{"3", "3"},
+	items := []Item[string, interface{}]{
+		{key: "1", value: "1"},
+		{key: "2", value: [2]float32{2., 2.}},
+		{key: "3", value: "3"},
 	}
 	for i := 4; i <= 10; i++ {
-		items = append(items, Item{strconv.Itoa(i), i})
+		items = append(items, Item[string, interface{}]{key: strconv.Itoa(i), value: i})
 	}
 
 	for i := 1; i <= 10; i++ {
@@ -209,7 +240,7 @@ func TestLRUCache_Delete_DeleteElementsSync_NoExtraElementsInCache(t *testing.T)
 	var wg sync.WaitGroup
 	wg.Add(len(items) - 2)
 	for i := 1; i <= len(items)-2; i++ {
-		go func(item Item) {
+		go func(item Item[string, interface{}]) {
 			_ = lru.Delete(item.key)
 			wg.Done()
 		}(items[i-1])
@@ -222,10 +253,116 @@ func TestLRUCache_Delete_DeleteElementsSync_NoExtraElementsInCache(t *testing.T)
 	assert.Equal(t, lru.Len(), 2)
 }
 
+// получение протухшего элемента
+func TestLRUCache_Get_ExpiredElement_RemovedAndReturnError(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lru := NewLRUCacheWithTTL[string, interface{}]("", 3, time.Minute)
+	lru.now = func() time.Time { return now }
+	lru.Add("one", "1")
+	lru.AddWithTTL("two", 2, time.Hour)
+	now = now.Add(time.Minute)
+
+	// Act
+	value, err := lru.Get("one")
+
+	// Assert
+	assert.Nil(t, value)
+	if assert.Error(t, err) {
+		assert.Equal(t, cache.ErrElementExpired, err)
+		assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	}
+	checkElement(t, lru, "front", "two", 2)
+	assert.Equal(t, lru.Len(), 1)
+}
+
+// получение элемента до истечения срока и бессрочного элемента
+func TestLRUCache_Get_NotExpiredElement_ReturnWithoutError(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lru := NewLRUCacheWithTTL[string, interface{}]("", 3, time.Minute)
+	lru.now = func() time.Time { return now }
+	lru.Add("one", "1")
+	lru.AddWithTTL("two", 2, 0)
+	now = now.Add(time.Minute - time.Second)
+
+	// Act
+	one, errOne := lru.Get("one")
+	now = now.Add(time.Hour)
+	two, errTwo := lru.Get("two")
+
+	// Assert
+	assert.NoError(t, errOne)
+	assert.Equal(t, "1", one)
+	assert.NoError(t, errTwo)
+	assert.Equal(t, 2, two)
+	assert.Equal(t, lru.Len(), 2)
+}
+
+// повторная вставка продлевает срок жизни элемента
+func TestLRUCache_Add_AddExistElement_TTLRenewed(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lru := NewLRUCacheWithTTL[string, interface{}]("", 3, time.Minute)
+	lru.now = func() time.Time { return now }
+	lru.Add("one", "1")
+	now = now.Add(time.Minute - time.Second)
+
+	// Act
+	lru.Add("one", 1)
+	now = now.Add(time.Minute - time.Second)
+	value, err := lru.Get("one")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+}
+
+// удаление протухших элементов
+func TestLRUCache_DeleteExpired_ExpiredElements_Removed(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	lru := NewLRUCache[string, interface{}]("", 4)
+	lru.now = func() time.Time { return now }
+	lru.AddWithTTL("one", "1", time.Minute)
+	lru.Add("two", 2)
+	lru.AddWithTTL("three", 3, time.Minute)
+	lru.AddWithTTL("four", "4", time.Hour)
+	now = now.Add(time.Minute)
+
+	// Act
+	count := lru.DeleteExpired()
+
+	// Assert
+	assert.Equal(t, 2, count)
+	checkElement(t, lru, "front", "four", "4")
+	checkElement(t, lru, "back", "two", 2)
+	assert.Equal(t, lru.Len(), 2)
+}
+
+// janitor удаляет протухшие элементы и останавливается по отмене контекста
+func TestLRUCache_RunJanitor_ExpiredElements_RemovedUntilCancel(t *testing.T) {
+	// Arrange
+	lru := NewLRUCacheWithTTL[string, interface{}]("", 3, time.Millisecond)
+	lru.Add("one", "1")
+	lru.AddWithTTL("two", 2, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	// Act
+	lru.RunJanitor(ctx, &wg, time.Millisecond)
+
+	// Assert
+	assert.Eventually(t, func() bool { return lru.Len() == 1 }, time.Second, time.Millisecond)
+	checkElement(t, lru, "front", "two", 2)
+	cancel()
+	wg.Wait()
+}
+
 // helpers
 
 func checkElement(t testing.TB,
-	lru *LRUCache, side string, key string, expected interface{}) {
+	lru *LRUCache[string, interface{}], side string, key string, expected interface{}) {
 
 	t.Helper()
 	var queueElem *list.Element
@@ -237,14 +374,14 @@ func checkElement(t testing.TB,
 		queueElem = lru.queue.Back()
 	} else {
 		for queueElem = lru.queue.Front(); queueElem != nil; queueElem = queueElem.Next() {
-			if queueElem.Value.(*Item).key == key {
+			if queueElem.Value.(*Item[string, interface{}]).key == key {
 				break
 			}
 		}
 		assert.NotNil(t, queueElem)
 	}
 	// value in map == value in queue
-	assert.Equal(t, queueElem.Value.(*Item).value, actual.Value.(*Item).value)
+	assert.Equal(t, queueElem.Value.(*Item[string, interface{}]).value, actual.Value.(*Item[string, interface{}]).value)
 	// value in map == expected
-	assert.Equal(t, expected, actual.Value.(*Item).value)
+	assert.Equal(t, expected, actual.Value.(*Item[string, interface{}]).value)
 }
@@ -0,0 +1,28 @@
+package cache_lru
+
+// Хэш-функции ключей для выбора шарда
+
+// HashString - FNV-1a строки
+func HashString(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// HashInt64 - перемешивание splitmix64, чтобы соседние id попадали в разные шарды
+func HashInt64(key int64) uint64 {
+	hash := uint64(key)
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
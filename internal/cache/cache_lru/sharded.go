@@ -0,0 +1,101 @@
+package cache_lru
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+)
+
+// ShardedLRUCache - набор независимых LRU со своими блокировками,
+// ключ попадает в шард по хэшу. Вытеснение идет внутри шарда,
+// поэтому порядок вытеснения приблизительный
+type ShardedLRUCache[K comparable, V any] struct {
+	name   string
+	shards []*LRUCache[K, V]
+	hash   func(K) uint64
+}
+
+var _ cache.Cache[string, interface{}] = (*ShardedLRUCache[string, interface{}])(nil)
+
+func NewShardedLRUCache[K comparable, V any](name string, capacity int,
+	shards int, hash func(K) uint64) *ShardedLRUCache[K, V] {
+
+	return NewShardedLRUCacheWithTTL[K, V](name, capacity, shards, 0, hash)
+}
+
+// NewShardedLRUCacheWithTTL делит capacity между shards шардами без остатка.
+// Шардов не больше capacity, чтобы в каждом был хотя бы один элемент
+func NewShardedLRUCacheWithTTL[K comparable, V any](name string, capacity int,
+	shards int, defaultTTL time.Duration, hash func(K) uint64) *ShardedLRUCache[K, V] {
+
+	if shards > capacity {
+		shards = capacity
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	sharded := &ShardedLRUCache[K, V]{
+		name:   name,
+		shards: make([]*LRUCache[K, V], shards),
+		hash:   hash,
+	}
+	for i := range sharded.shards {
+		shardCapacity := capacity / shards
+		if i < capacity%shards {
+			shardCapacity++
+		}
+		if shardCapacity < 1 {
+			shardCapacity = 1
+		}
+		sharded.shards[i] = NewLRUCacheWithTTL[K, V](name, shardCapacity, defaultTTL)
+	}
+	return sharded
+}
+
+func (s *ShardedLRUCache[K, V]) Name() string {
+	return s.name
+}
+
+func (s *ShardedLRUCache[K, V]) Add(key K, value V) bool {
+	return s.shard(key).Add(key, value)
+}
+
+func (s *ShardedLRUCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) bool {
+	return s.shard(key).AddWithTTL(key, value, ttl)
+}
+
+func (s *ShardedLRUCache[K, V]) Get(key K) (V, error) {
+	return s.shard(key).Get(key)
+}
+
+func (s *ShardedLRUCache[K, V]) Len() int {
+	var length int
+	for _, shard := range s.shards {
+		length += shard.Len()
+	}
+	return length
+}
+
+func (s *ShardedLRUCache[K, V]) Delete(key K) error {
+	return s.shard(key).Delete(key)
+}
+
+// DeleteExpired удаляет протухшие элементы во всех шардах
+func (s *ShardedLRUCache[K, V]) DeleteExpired() int {
+	var count int
+	for _, shard := range s.shards {
+		count += shard.DeleteExpired()
+	}
+	return count
+}
+
+// RunJanitor раз в interval удаляет протухшие элементы, пока не отменен ctx
+func (s *ShardedLRUCache[K, V]) RunJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	cache.RunJanitor(ctx, wg, interval, s.DeleteExpired)
+}
+
+func (s *ShardedLRUCache[K, V]) shard(key K) *LRUCache[K, V] {
+	return s.shards[s.hash(key)%uint64(len(s.shards))]
+}
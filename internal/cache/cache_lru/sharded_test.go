@@ -0,0 +1,111 @@
+package cache_lru
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// емкость делится между шардами без остатка, шардов не больше емкости
+func TestShardedLRUCache_New_Capacity_DividedBetweenShards(t *testing.T) {
+	// Act
+	sharded := NewShardedLRUCache[string, int]("", 10, 4, HashString)
+	small := NewShardedLRUCache[string, int]("", 2, 4, HashString)
+
+	// Assert
+	capacities := make([]int, 0, 4)
+	for _, shard := range sharded.shards {
+		capacities = append(capacities, shard.capacity)
+	}
+	assert.Equal(t, []int{3, 3, 2, 2}, capacities)
+	if assert.Len(t, small.shards, 2) {
+		for _, shard := range small.shards {
+			assert.Equal(t, 1, shard.capacity)
+		}
+	}
+}
+
+// элементы находятся по ключу, вытеснение идет внутри шарда
+func TestShardedLRUCache_Add_FullShard_OldestInShardRemoved(t *testing.T) {
+	// Arrange
+	sharded := NewShardedLRUCache[int64, string]("", 4, 2, func(key int64) uint64 { return uint64(key) })
+	sharded.Add(0, "0")
+	sharded.Add(1, "1")
+	sharded.Add(2, "2")
+
+	// Act
+	eviction := sharded.Add(4, "4")
+
+	// Assert
+	assert.True(t, eviction)
+	_, err := sharded.Get(0)
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	for key, expected := range map[int64]string{1: "1", 2: "2", 4: "4"} {
+		value, err := sharded.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+	assert.Equal(t, sharded.Len(), 3)
+}
+
+// удаление и протухание элементов во всех шардах
+func TestShardedLRUCache_DeleteExpired_ExpiredElements_RemovedInAllShards(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	sharded := NewShardedLRUCacheWithTTL[string, int]("", 10, 4, time.Minute, HashString)
+	for _, shard := range sharded.shards {
+		shard.now = func() time.Time { return now }
+	}
+	for i := 0; i < 8; i++ {
+		sharded.Add(strconv.Itoa(i), i)
+	}
+	sharded.AddWithTTL("forever", 8, 0)
+	_ = sharded.Delete("0")
+	now = now.Add(time.Minute)
+
+	// Act
+	count := sharded.DeleteExpired()
+
+	// Assert
+	assert.Equal(t, 7, count)
+	value, err := sharded.Get("forever")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, value)
+	assert.Equal(t, sharded.Len(), 1)
+}
+
+// одновременные вставка, чтение и удаление, запускается с go test -race
+func TestShardedLRUCache_MixedOperationsSync_NoRaceAndCapacityKept(t *testing.T) {
+	// Arrange
+	sharded := NewShardedLRUCache[int64, int64]("", 64, 8, HashInt64)
+
+	// Act
+	var wg sync.WaitGroup
+	wg.Add(8)
+	for i := 0; i < 8; i++ {
+		go func(i int64) {
+			defer wg.Done()
+			for j := int64(0); j < 500; j++ {
+				key := (i*500 + j) % 100
+				sharded.Add(key, key)
+				if value, err := sharded.Get(key); err == nil {
+					assert.Equal(t, key, value)
+				}
+				if j%7 == 0 {
+					_ = sharded.Delete(key)
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// Assert
+	assert.LessOrEqual(t, sharded.Len(), 64)
+	for _, shard := range sharded.shards {
+		assert.Equal(t, shard.queue.Len(), len(shard.values))
+	}
+}
@@ -0,0 +1,233 @@
+package cache_redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// RedisCache хранит значения в redis, общем для всех реплик бота, и держит
+// копии прочитанных значений в локальном LRU. Изменение и удаление ключа
+// публикуются в канал инвалидации, остальные реплики удаляют свои локальные копии.
+// Пока подписка на канал оборвана, локальные копии не используются,
+// а после переподключения все прежние копии считаются устаревшими.
+// Вытеснением из самого redis управляет его maxmemory-policy
+type RedisCache[K comparable, V any] struct {
+	name       string
+	client     *redis.Client
+	timeout    time.Duration
+	local      *cache_lru.LRUCache[string, entry[V]]
+	defaultTTL time.Duration
+	keyPrefix  string
+	channel    string
+	instance   string
+	logger     *zap.Logger
+	// Обработчик инвалидаций от других реплик, может быть nil
+	onInvalidateKey func(key string)
+
+	// Подписка на канал инвалидации активна
+	online atomic.Bool
+	// Номер подписки, копии из прошлых подписок устарели
+	epoch atomic.Uint64
+	// Количество полученных инвалидаций, чтобы не сохранить копию,
+	// инвалидированную во время чтения из redis
+	invalidations atomic.Uint64
+}
+
+var _ cache.Cache[string, interface{}] = (*RedisCache[string, interface{}])(nil)
+
+type entry[V any] struct {
+	value V
+	epoch uint64
+}
+
+// New создает кэш name с локальной копией на capacity элементов и запускает
+// подписку на канал инвалидации до отмены ctx
+func New[K comparable, V any](ctx context.Context, wg *sync.WaitGroup, name string,
+	capacity int, defaultTTL time.Duration, options Options) (*RedisCache[K, V], error) {
+
+	options = options.withDefaults()
+	instance := make([]byte, 8)
+	if _, err := rand.Read(instance); err != nil {
+		return nil, errors.Wrap(err, "redis cache instance id")
+	}
+
+	c := &RedisCache[K, V]{
+		name:       name,
+		client:     newClient(options),
+		timeout:    options.Timeout,
+		local:      cache_lru.NewLRUCacheWithTTL[string, entry[V]](name, capacity, defaultTTL),
+		defaultTTL: defaultTTL,
+		keyPrefix:  options.Prefix + ":" + name + ":",
+		channel:    options.Prefix + ":invalidate:" + name,
+		instance:   hex.EncodeToString(instance),
+		logger:     options.Logger,
+
+		onInvalidateKey: options.OnInvalidate,
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer c.client.Close()
+
+		subscribe(ctx, c.client, c.logger, c.channel, c.timeout, func() {
+			c.epoch.Add(1)
+			c.online.Store(true)
+		}, func() {
+			c.online.Store(false)
+		}, c.onInvalidate)
+	}()
+
+	return c, nil
+}
+
+func (c *RedisCache[K, V]) Name() string {
+	return c.name
+}
+
+func (c *RedisCache[K, V]) Add(key K, value V) bool {
+	return c.AddWithTTL(key, value, c.defaultTTL)
+}
+
+// AddWithTTL записывает значение в redis и сообщает остальным репликам об изменении.
+// Если redis недоступен, значение не сохраняется, и Get его не найдет
+func (c *RedisCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) bool {
+	localKey := keyString(key)
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.logger.Error("redis cache encode failed", zap.String("cache", c.name), zap.Error(err))
+		return false
+	}
+
+	epoch := c.epoch.Load()
+	invalidations := c.invalidations.Load()
+	_, err = c.client.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), c.keyPrefix+localKey, data, ttl)
+		c.publishInvalidation(pipe, localKey)
+		return nil
+	})
+	if err != nil {
+		c.logger.Warn("redis cache set failed", zap.String("cache", c.name), zap.Error(err))
+		_ = c.local.Delete(localKey)
+		return false
+	}
+
+	// Другая реплика могла изменить ключ одновременно с записью,
+	// тогда в redis может остаться ее значение, и копия не сохраняется
+	if !c.localCopyValid(epoch, invalidations) {
+		_ = c.local.Delete(localKey)
+		return false
+	}
+	return c.local.AddWithTTL(localKey, entry[V]{value: value, epoch: epoch}, ttl)
+}
+
+func (c *RedisCache[K, V]) Get(key K) (V, error) {
+	var zero V
+	localKey := keyString(key)
+
+	epoch := c.epoch.Load()
+	if c.online.Load() {
+		if e, err := c.local.Get(localKey); err == nil && e.epoch == epoch {
+			return e.value, nil
+		}
+	}
+
+	invalidations := c.invalidations.Load()
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := c.client.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		get = pipe.Get(context.Background(), c.keyPrefix+localKey)
+		pttl = pipe.PTTL(context.Background(), c.keyPrefix+localKey)
+		return nil
+	})
+	if err == redis.Nil {
+		return zero, cache.ErrElementNotInCache
+	}
+	if err != nil {
+		return zero, errors.Wrap(err, "redis cache get")
+	}
+	var value V
+	if err = json.Unmarshal([]byte(get.Val()), &value); err != nil {
+		return zero, errors.Wrap(err, "redis cache decode")
+	}
+
+	// Оставшийся срок жизни в redis, отрицательный - бессрочно
+	var ttl time.Duration
+	if pttl.Val() > 0 {
+		ttl = pttl.Val()
+	}
+	if c.localCopyValid(epoch, invalidations) {
+		c.local.AddWithTTL(localKey, entry[V]{value: value, epoch: epoch}, ttl)
+	}
+	return value, nil
+}
+
+// Len - количество локальных копий, размер redis не запрашивается
+func (c *RedisCache[K, V]) Len() int {
+	return c.local.Len()
+}
+
+// Delete удаляет значение из redis и сообщает остальным репликам
+func (c *RedisCache[K, V]) Delete(key K) error {
+	localKey := keyString(key)
+	localErr := c.local.Delete(localKey)
+
+	var del *redis.IntCmd
+	_, err := c.client.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		del = pipe.Del(context.Background(), c.keyPrefix+localKey)
+		c.publishInvalidation(pipe, localKey)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "redis cache delete")
+	}
+	if del.Val() == 0 && localErr != nil {
+		return cache.ErrElementNotInCache
+	}
+	return nil
+}
+
+// DeleteExpired удаляет протухшие локальные копии, из redis они удаляются им самим
+func (c *RedisCache[K, V]) DeleteExpired() int {
+	return c.local.DeleteExpired()
+}
+
+// Публикация инвалидации ключа: "<id реплики> <ключ>"
+func (c *RedisCache[K, V]) publishInvalidation(pipe redis.Pipeliner, localKey string) {
+	pipe.Publish(context.Background(), c.channel, c.instance+" "+localKey)
+}
+
+// Локальную копию можно сохранить, только если подписка не обрывалась
+// и за время запроса к redis не пришло инвалидаций
+func (c *RedisCache[K, V]) localCopyValid(epoch uint64, invalidations uint64) bool {
+	return c.online.Load() && c.epoch.Load() == epoch && c.invalidations.Load() == invalidations
+}
+
+func (c *RedisCache[K, V]) onInvalidate(payload string) {
+	instance, localKey, ok := strings.Cut(payload, " ")
+	if !ok || instance == c.instance {
+		return
+	}
+	c.invalidations.Add(1)
+	_ = c.local.Delete(localKey)
+	if c.onInvalidateKey != nil {
+		c.onInvalidateKey(localKey)
+	}
+}
+
+func keyString[K comparable](key K) string {
+	return fmt.Sprint(key)
+}
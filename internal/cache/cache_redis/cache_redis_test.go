@@ -0,0 +1,259 @@
+package cache_redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, password string) *miniredis.Miniredis {
+	server := miniredis.RunT(t)
+	if password != "" {
+		server.RequireAuth(password)
+	}
+	return server
+}
+
+// Кэш с подпиской на канал инвалидации, останавливается в конце теста
+func newTestCache(t *testing.T, server *miniredis.Miniredis, options Options) *RedisCache[string, string] {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	options.Addr = server.Addr()
+	if options.Timeout == 0 {
+		options.Timeout = 100 * time.Millisecond
+	}
+	c, err := New[string, string](ctx, wg, "test", 10, 0, options)
+	require.NoError(t, err)
+	require.Eventually(t, c.online.Load, time.Second, time.Millisecond)
+	return c
+}
+
+// значение, записанное одной репликой, читается другой
+func TestRedisCache_Get_AddedByOtherInstance_Found(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{})
+	first.Add("one", "1")
+
+	// Act
+	value, err := second.Get("one")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, []string{"gospend:test:one"}, server.Keys())
+}
+
+// отсутствующий ключ
+func TestRedisCache_Get_MissingKey_NotInCache(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	c := newTestCache(t, server, Options{})
+
+	// Act
+	_, getErr := c.Get("one")
+	deleteErr := c.Delete("one")
+
+	// Assert
+	assert.ErrorIs(t, getErr, cache.ErrElementNotInCache)
+	assert.ErrorIs(t, deleteErr, cache.ErrElementNotInCache)
+}
+
+// изменение значения одной репликой удаляет локальную копию другой
+func TestRedisCache_Add_ChangedByOtherInstance_LocalCopyInvalidated(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{})
+	first.Add("one", "1")
+	// Инвалидация от записи приходит асинхронно, копия сохраняется после нее
+	require.Eventually(t, func() bool { return second.invalidations.Load() == 1 }, time.Second, time.Millisecond)
+	_, err := second.Get("one")
+	require.NoError(t, err)
+	require.Equal(t, 1, second.Len())
+
+	// Act
+	first.Add("one", "2")
+
+	// Assert
+	assert.Eventually(t, func() bool { return second.Len() == 0 }, time.Second, time.Millisecond)
+	value, err := second.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+// удаление значения одной репликой удаляет локальную копию другой
+func TestRedisCache_Delete_DeletedByOtherInstance_NotInCache(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{})
+	first.Add("one", "1")
+	_, err := second.Get("one")
+	require.NoError(t, err)
+
+	// Act
+	err = first.Delete("one")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return second.Len() == 0 }, time.Second, time.Millisecond)
+	_, err = second.Get("one")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+}
+
+// обработчик получает ключи, измененные другими репликами, но не своей
+func TestRedisCache_OnInvalidate_CalledForOtherInstanceOnly(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	keys := make(chan string, 2)
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{OnInvalidate: func(key string) { keys <- key }})
+
+	// Act
+	second.Add("own", "1")
+	first.Add("one", "1")
+	err := first.Delete("one")
+
+	// Assert
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		select {
+		case key := <-keys:
+			assert.Equal(t, "one", key)
+		case <-time.After(time.Second):
+			t.Fatal("invalidation not received")
+		}
+	}
+}
+
+// срок жизни задается в redis и переносится в локальную копию
+func TestRedisCache_AddWithTTL_Expired_NotInCache(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{})
+	first.AddWithTTL("one", "1", 50*time.Millisecond)
+	_, err := second.Get("one")
+	require.NoError(t, err)
+
+	// Act
+	// Время miniredis идет только вручную, локальные копии протухают по часам
+	server.FastForward(60 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+
+	// Assert
+	_, err = first.Get("one")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	_, err = second.Get("one")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+}
+
+// после обрыва подписки инвалидации могли потеряться, локальные копии не используются
+func TestRedisCache_Get_AfterReconnect_LocalCopyDiscarded(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	first := newTestCache(t, server, Options{})
+	second := newTestCache(t, server, Options{})
+	first.Add("one", "1")
+	_, err := second.Get("one")
+	require.NoError(t, err)
+	epoch := second.epoch.Load()
+
+	// Act
+	server.Close()
+	require.Eventually(t, func() bool { return !second.online.Load() }, time.Second, time.Millisecond)
+	require.NoError(t, server.Restart())
+	first.Add("one", "2")
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		return second.online.Load() && second.epoch.Load() > epoch
+	}, time.Second, time.Millisecond)
+	value, err := second.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+// авторизация и выбор базы при подключении
+func TestRedisCache_Get_WithPassword_Found(t *testing.T) {
+	// Arrange
+	server := startServer(t, "secret")
+	c := newTestCache(t, server, Options{Password: "secret", DB: 1, Prefix: "bot"})
+	c.Add("one", "1")
+
+	// Act
+	value, err := c.Get("one")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, []string{"bot:test:one"}, server.DB(1).Keys())
+}
+
+// копия не сохраняется, если ключ изменила другая реплика во время записи
+func TestRedisCache_AddWithTTL_InvalidatedDuringWrite_LocalCopyNotSaved(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	c := newTestCache(t, server, Options{})
+	c.client.AddHook(pipelineHook(func() { c.onInvalidate("other one") }))
+
+	// Act
+	c.Add("one", "1")
+
+	// Assert
+	assert.Zero(t, c.Len())
+	value, err := c.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
+
+// redis недоступен
+func TestRedisCache_ServerClosed_ErrorAndNothingCached(t *testing.T) {
+	// Arrange
+	server := startServer(t, "")
+	c := newTestCache(t, server, Options{})
+	c.Add("one", "1")
+
+	// Act
+	server.Close()
+	eviction := c.Add("two", "2")
+	_, err := c.Get("three")
+
+	// Assert
+	assert.False(t, eviction)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, cache.ErrElementNotInCache)
+	assert.Eventually(t, func() bool { return !c.online.Load() }, time.Second, time.Millisecond)
+}
+
+// pipelineHook вызывает before перед каждым пакетом команд
+type pipelineHook func()
+
+func (h pipelineHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h pipelineHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h pipelineHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h()
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,108 @@
+package cache_redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPrefix   = "gospend"
+	defaultTimeout  = time.Second
+	defaultPoolSize = 8
+)
+
+type Options struct {
+	// Адрес redis, host:port
+	Addr string
+	// Пароль для AUTH, пустой - без авторизации
+	Password string
+	// Номер базы для SELECT
+	DB int
+	// Префикс ключей и каналов, по умолчанию gospend
+	Prefix string
+	// Таймаут подключения и одной команды, по умолчанию секунда
+	Timeout time.Duration
+	// Количество соединений для команд, по умолчанию 8
+	PoolSize int
+	Logger   *zap.Logger
+	// Вызывается с ключом, который изменила или удалила другая реплика.
+	// Вызовы идут из горутины подписки по порядку получения инвалидаций
+	OnInvalidate func(key string)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Prefix == "" {
+		o.Prefix = defaultPrefix
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.PoolSize <= 0 {
+		o.PoolSize = defaultPoolSize
+	}
+	if o.Logger == nil {
+		o.Logger = zap.NewNop()
+	}
+	return o
+}
+
+func newClient(options Options) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:         options.Addr,
+		Password:     options.Password,
+		DB:           options.DB,
+		DialTimeout:  options.Timeout,
+		ReadTimeout:  options.Timeout,
+		WriteTimeout: options.Timeout,
+		PoolSize:     options.PoolSize,
+	})
+}
+
+// subscribe слушает канал, пока не отменен ctx. После обрыва клиент сам
+// переподключается и подписывается заново. onSubscribed вызывается после
+// каждой успешной подписки, onLost - при обрыве
+func subscribe(ctx context.Context, client *redis.Client, logger *zap.Logger, channel string,
+	retryDelay time.Duration, onSubscribed func(), onLost func(), onMessage func(payload string)) {
+
+	pubsub := client.Subscribe(ctx, channel)
+	// Чтение сообщений блокируется без таймаута, отмена ctx закрывает подписку
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = pubsub.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			onLost()
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("redis subscription lost", zap.String("channel", channel), zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				onSubscribed()
+			}
+		case *redis.Message:
+			onMessage(msg.Payload)
+		}
+	}
+}
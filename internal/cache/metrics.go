@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsCache - декоратор, который снимает метрики с любой реализации кэша:
+// попадания, промахи, вытеснения, протухания, размер и время операций.
+// Счетчики с меткой имени кэша берутся один раз, чтобы не искать их на каждой операции
+type MetricsCache[K comparable, V any] struct {
+	cache     Cache[K, V]
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions prometheus.Counter
+	expired   prometheus.Counter
+	size      prometheus.Gauge
+	addTime   prometheus.Observer
+	getTime   prometheus.Observer
+	delTime   prometheus.Observer
+}
+
+var _ Cache[string, interface{}] = (*MetricsCache[string, interface{}])(nil)
+
+// WithMetrics оборачивает кэш, метки метрик - имя кэша
+func WithMetrics[K comparable, V any](cache Cache[K, V]) *MetricsCache[K, V] {
+	name := cache.Name()
+	return &MetricsCache[K, V]{
+		cache:     cache,
+		hits:      observability.CacheHitCountVec.WithLabelValues(name),
+		misses:    observability.CacheMissCountVec.WithLabelValues(name),
+		evictions: observability.CacheEvictionCountVec.WithLabelValues(name),
+		expired:   observability.CacheExpiredCountVec.WithLabelValues(name),
+		size:      observability.CacheKeyCountVec.WithLabelValues(name),
+		addTime:   observability.HistogramCacheTimeVec.WithLabelValues(name, "add"),
+		getTime:   observability.HistogramCacheTimeVec.WithLabelValues(name, "get"),
+		delTime:   observability.HistogramCacheTimeVec.WithLabelValues(name, "delete"),
+	}
+}
+
+// Unwrap возвращает обернутый кэш
+func (m *MetricsCache[K, V]) Unwrap() Cache[K, V] {
+	return m.cache
+}
+
+func (m *MetricsCache[K, V]) Name() string {
+	return m.cache.Name()
+}
+
+func (m *MetricsCache[K, V]) Add(key K, value V) bool {
+	start := time.Now()
+	eviction := m.cache.Add(key, value)
+	m.addTime.Observe(time.Since(start).Seconds())
+
+	m.countAdd(eviction)
+	return eviction
+}
+
+func (m *MetricsCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) bool {
+	start := time.Now()
+	eviction := m.cache.AddWithTTL(key, value, ttl)
+	m.addTime.Observe(time.Since(start).Seconds())
+
+	m.countAdd(eviction)
+	return eviction
+}
+
+func (m *MetricsCache[K, V]) Get(key K) (V, error) {
+	start := time.Now()
+	value, err := m.cache.Get(key)
+	m.getTime.Observe(time.Since(start).Seconds())
+
+	switch {
+	case err == nil:
+		m.hits.Inc()
+	case errors.Is(err, ErrElementExpired):
+		m.misses.Inc()
+		m.expired.Inc()
+		m.updateSize()
+	default:
+		m.misses.Inc()
+	}
+	return value, err
+}
+
+func (m *MetricsCache[K, V]) Len() int {
+	return m.cache.Len()
+}
+
+func (m *MetricsCache[K, V]) Delete(key K) error {
+	start := time.Now()
+	err := m.cache.Delete(key)
+	m.delTime.Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		m.updateSize()
+	}
+	return err
+}
+
+// DeleteExpired удаляет протухшие элементы, если обернутый кэш это умеет
+func (m *MetricsCache[K, V]) DeleteExpired() int {
+	expiring, ok := m.cache.(interface{ DeleteExpired() int })
+	if !ok {
+		return 0
+	}
+
+	count := expiring.DeleteExpired()
+	if count > 0 {
+		m.expired.Add(float64(count))
+		m.updateSize()
+	}
+	return count
+}
+
+func (m *MetricsCache[K, V]) countAdd(eviction bool) {
+	if eviction {
+		m.evictions.Inc()
+	}
+	m.updateSize()
+}
+
+// Размер берется у кэша, а не считается по операциям, поэтому не расходится с ним
+func (m *MetricsCache[K, V]) updateSize() {
+	m.size.Set(float64(m.cache.Len()))
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// операции через декоратор попадают в метрики кэша
+func TestMetricsCache_Operations_Counted(t *testing.T) {
+	// Arrange
+	name := t.Name()
+	before := snapshot(name)
+	fake := &fakeCache{name: name, capacity: 2, values: map[string]int{}}
+	m := WithMetrics[string, int](fake)
+	m.Add("one", 1)
+	m.Add("two", 2)
+
+	// Act
+	m.AddWithTTL("three", 3, time.Minute)
+	_, _ = m.Get("three")
+	_, _ = m.Get("missing")
+	_ = m.Delete("missing")
+	_ = m.Delete("three")
+
+	// Assert
+	after := snapshot(name)
+	assert.Equal(t, 1., after.hits-before.hits)
+	assert.Equal(t, 1., after.misses-before.misses)
+	assert.Equal(t, 1., after.evictions-before.evictions)
+	assert.Equal(t, 1., after.keys)
+	assert.Equal(t, uint64(3), after.addCount-before.addCount)
+	assert.Equal(t, uint64(2), after.getCount-before.getCount)
+	assert.Equal(t, uint64(2), after.delCount-before.delCount)
+}
+
+// протухание при чтении и при очистке считается отдельно от промахов
+func TestMetricsCache_Expired_CountedAndSizeUpdated(t *testing.T) {
+	// Arrange
+	name := t.Name()
+	before := snapshot(name)
+	fake := &fakeCache{name: name, capacity: 10, values: map[string]int{}}
+	m := WithMetrics[string, int](fake)
+	m.Add("one", 1)
+	m.Add("two", 2)
+	m.Add("three", 3)
+	fake.expired = map[string]bool{"one": true, "two": true}
+
+	// Act
+	_, err := m.Get("one")
+	count := m.DeleteExpired()
+
+	// Assert
+	assert.ErrorIs(t, err, ErrElementNotInCache)
+	assert.Equal(t, 1, count)
+	after := snapshot(name)
+	assert.Equal(t, 2., after.expired-before.expired)
+	assert.Equal(t, 1., after.misses-before.misses)
+	assert.Equal(t, 1., after.keys)
+}
+
+// helpers
+
+type metricsSnapshot struct {
+	hits, misses, evictions, expired, keys float64
+	addCount, getCount, delCount           uint64
+}
+
+func snapshot(name string) metricsSnapshot {
+	return metricsSnapshot{
+		hits:      testutil.ToFloat64(observability.CacheHitCountVec.WithLabelValues(name)),
+		misses:    testutil.ToFloat64(observability.CacheMissCountVec.WithLabelValues(name)),
+		evictions: testutil.ToFloat64(observability.CacheEvictionCountVec.WithLabelValues(name)),
+		expired:   testutil.ToFloat64(observability.CacheExpiredCountVec.WithLabelValues(name)),
+		keys:      testutil.ToFloat64(observability.CacheKeyCountVec.WithLabelValues(name)),
+		addCount:  sampleCount(name, "add"),
+		getCount:  sampleCount(name, "get"),
+		delCount:  sampleCount(name, "delete"),
+	}
+}
+
+func sampleCount(name, operation string) uint64 {
+	var metric dto.Metric
+	_ = observability.HistogramCacheTimeVec.WithLabelValues(name, operation).(prometheus.Histogram).Write(&metric)
+	return metric.GetHistogram().GetSampleCount()
+}
+
+// Кэш без политики: при заполнении вытесняет произвольный ключ,
+// ключи из expired считаются протухшими
+type fakeCache struct {
+	name     string
+	capacity int
+	values   map[string]int
+	expired  map[string]bool
+}
+
+func (f *fakeCache) Name() string { return f.name }
+
+func (f *fakeCache) Add(key string, value int) bool {
+	return f.AddWithTTL(key, value, 0)
+}
+
+func (f *fakeCache) AddWithTTL(key string, value int, _ time.Duration) (eviction bool) {
+	if _, ok := f.values[key]; !ok && len(f.values) == f.capacity {
+		for k := range f.values {
+			delete(f.values, k)
+			break
+		}
+		eviction = true
+	}
+	f.values[key] = value
+	return eviction
+}
+
+func (f *fakeCache) Get(key string) (int, error) {
+	value, ok := f.values[key]
+	if !ok {
+		return 0, ErrElementNotInCache
+	}
+	if f.expired[key] {
+		delete(f.values, key)
+		return 0, ErrElementExpired
+	}
+	return value, nil
+}
+
+func (f *fakeCache) Len() int { return len(f.values) }
+
+func (f *fakeCache) Delete(key string) error {
+	if _, ok := f.values[key]; !ok {
+		return ErrElementNotInCache
+	}
+	delete(f.values, key)
+	return nil
+}
+
+func (f *fakeCache) DeleteExpired() int {
+	var count int
+	for key := range f.expired {
+		if _, ok := f.values[key]; ok {
+			delete(f.values, key)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ExpiresAt - момент протухания элемента, добавленного в now со сроком жизни ttl,
+// нулевое время - бессрочный элемент
+func ExpiresAt(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// Expired - протух ли к моменту now элемент со сроком expiresAt
+func Expired(expiresAt time.Time, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// RunJanitor раз в interval вызывает deleteExpired, пока не отменен ctx
+func RunJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, deleteExpired func() int) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				deleteExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cr00z/goSpendingBot/internal/model/messages"
+	"github.com/cr00z/goSpendingBot/internal/report_service/local"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const promptStr = "> "
+
+// Client - фронтенд бота для терминала: читает сообщения из входного потока
+// и печатает ответы. Строки, начинающиеся с #, пропускаются, префикс @<id>
+// отправляет сообщение от имени другого пользователя.
+// Строка "/restore <файл>" отправляет файл с подписью /restore,
+// файлы от бота печатаются вместе с именем
+type Client struct {
+	sync.Mutex
+	out    io.Writer
+	prompt bool
+	logger *zap.Logger
+	// id последнего сообщения для SendMessageWithID
+	lastID int
+}
+
+func New(out io.Writer, prompt bool, logger *zap.Logger) *Client {
+	return &Client{
+		out:    out,
+		prompt: prompt,
+		logger: logger,
+	}
+}
+
+func (c *Client) SendMessage(ctx context.Context, text string, userID int64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	_, err := fmt.Fprintln(c.out, text)
+	if err != nil {
+		return errors.Wrap(err, "write message")
+	}
+	return nil
+}
+
+// SendMessageWithID печатает сообщение и возвращает его порядковый номер
+func (c *Client) SendMessageWithID(ctx context.Context, text string, userID int64) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	_, err := fmt.Fprintln(c.out, text)
+	if err != nil {
+		return 0, errors.Wrap(err, "write message")
+	}
+	c.lastID++
+	return c.lastID, nil
+}
+
+// EditMessage печатает новый текст сообщения, напечатанное в терминале не меняется
+func (c *Client) EditMessage(ctx context.Context, text string, userID int64, messageID int) error {
+	return c.SendMessage(ctx, text, userID)
+}
+
+func (c *Client) SendDocument(ctx context.Context, name string, data []byte, userID int64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	_, err := fmt.Fprintf(c.out, "%s:\n%s\n", name, data)
+	if err != nil {
+		return errors.Wrap(err, "write document")
+	}
+	return nil
+}
+
+func (c *Client) printPrompt() {
+	if c.prompt {
+		c.Lock()
+		fmt.Fprint(c.out, promptStr)
+		c.Unlock()
+	}
+}
+
+// ListenInput передает строки из in в модель до конца ввода или завершения контекста.
+// После каждого сообщения дожидается отчетов, запрошенных у reports, чтобы отчет
+// выводился после ответа бота, как при работе через сервис отчетов
+func (c *Client) ListenInput(ctx context.Context, in io.Reader, userID int64,
+	msgModel *messages.Model, reports *local.Producer) error {
+
+	scanner := bufio.NewScanner(in)
+	c.printPrompt()
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		msg, ok := parseLine(scanner.Text(), userID)
+		if ok {
+			err := attachDocument(&msg)
+			if err == nil {
+				err = msgModel.IncomingMessage(ctx, msg)
+			}
+			if err != nil {
+				c.logger.Warn(
+					"error processing message:",
+					zap.Error(err),
+				)
+			}
+
+			reports.Wait()
+		}
+		c.printPrompt()
+	}
+
+	return scanner.Err()
+}
+
+func parseLine(line string, userID int64) (messages.Message, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return messages.Message{}, false
+	}
+
+	if strings.HasPrefix(line, "@") {
+		elements := strings.SplitN(line[1:], " ", 2)
+		if id, err := strconv.ParseInt(elements[0], 10, 64); err == nil {
+			userID = id
+			line = ""
+			if len(elements) == 2 {
+				line = strings.TrimSpace(elements[1])
+			}
+		}
+	}
+
+	return messages.Message{
+		Text:   line,
+		UserID: userID,
+	}, true
+}
+
+// Команда, после которой передается путь к отправляемому файлу
+const commandWithDocument = "/restore"
+
+// attachDocument заменяет путь к файлу в сообщении его содержимым
+func attachDocument(msg *messages.Message) error {
+	elements := strings.SplitN(msg.Text, " ", 2)
+	if elements[0] != commandWithDocument || len(elements) == 1 {
+		return nil
+	}
+
+	document, err := os.ReadFile(strings.TrimSpace(elements[1]))
+	if err != nil {
+		return errors.Wrap(err, "read document")
+	}
+	msg.Text = commandWithDocument
+	msg.Document = document
+	return nil
+}
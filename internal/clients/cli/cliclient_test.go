@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/currency/fixedcurrency"
+	"github.com/cr00z/goSpendingBot/internal/model/messages"
+	"github.com/cr00z/goSpendingBot/internal/report_service/local"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	client := New(&out, false, zap.NewNop())
+	store := memory.NewMemoryStorage()
+	reportService := local.New(store, zap.NewNop())
+	model := messages.New(client, store,
+		cache_lru.NewLRUCache[int64, string]("currency", 10),
+		cache_lru.NewLRUCache[string, *repository.Report]("report", 10),
+		fixedcurrency.NewFixedCurrencyStorage(nil),
+		reportService,
+	)
+	reportService.SetReceiver(model.DeliverReport)
+
+	err := client.ListenInput(context.Background(), strings.NewReader(script), 1, model, reportService)
+	assert.NoError(t, err)
+
+	return out.String()
+}
+
+func Test_ListenInput_Script_ShouldPrintReplies(t *testing.T) {
+	script := `
+# категории и траты первого пользователя
+/newcat coffee
+/newcat coffee
+food 100
+/newcat food
+food 100
+coffee 250 yesterday
+/listcat
+/repw
+# второй пользователь не видит чужих категорий
+@2 /listcat
+`
+	expected := `Category 'coffee' added
+Category 'coffee' already exists
+Unknown category 'food', create it with /newcat food or use /addexp
+Category 'food' added
+Exspense added
+Exspense added
+*Categories:*
+coffee
+food
+Preparing report…
+*Report:*
+coffee: 250.00 RUB
+food: 100.00 RUB
+*Categories:* empty
+`
+
+	assert.Equal(t, expected, runScript(t, script))
+}
+
+func Test_ListenInput_Restore_ShouldLoadFileOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.json")
+	document := `{
+		"version": 1,
+		"currency": "RUB",
+		"limit": "5000",
+		"categories": ["food", "taxi"],
+		"spendings": [{"category": "food", "amount": "100", "date": "2022-11-20T12:00:00Z"}]
+	}`
+	require.NoError(t, os.WriteFile(path, []byte(document), 0o600))
+	script := "/restore " + path + "\n/restore " + path + "\n/listcat\n/limitget\n/restore missing.json\n"
+
+	expected := `*Restored:* 2 categories, 1 expenses
+*Restored:* 0 categories, 0 expenses
+*Categories:*
+food
+taxi
+*Month limit:* 5000 RUB
+`
+
+	assert.Equal(t, expected, runScript(t, script))
+}
+
+func Test_ListenInput_Backup_ShouldPrintDocument(t *testing.T) {
+	out := runScript(t, "/newcat food\n/backup\n")
+
+	assert.Contains(t, out, `"version": 1`)
+	assert.Contains(t, out, `"categories": [
+    "food"
+  ]`)
+	assert.Contains(t, out, "*Backup:* 1 categories, 0 expenses")
+}
+
+func Test_ParseLine_UserPrefix_ShouldChangeUser(t *testing.T) {
+	msg, ok := parseLine("@42 /listcat", 1)
+
+	assert.True(t, ok)
+	assert.Equal(t, messages.Message{Text: "/listcat", UserID: 42}, msg)
+}
+
+func Test_ParseLine_Comment_ShouldSkip(t *testing.T) {
+	_, ok := parseLine("  # comment", 1)
+
+	assert.False(t, ok)
+}
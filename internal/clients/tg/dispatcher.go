@@ -0,0 +1,104 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultUpdateWorkers   = 8
+	defaultUpdateQueueSize = 100
+)
+
+type dispatchItem struct {
+	update     tgbotapi.Update
+	enqueuedAt time.Time
+}
+
+// dispatcher обрабатывает обновления параллельно в пуле воркеров.
+// Обновления одного пользователя всегда попадают в один воркер,
+// поэтому порядок их обработки сохраняется
+type dispatcher struct {
+	queues []chan dispatchItem
+	handle func(ctx context.Context, update tgbotapi.Update)
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers int, queueSize int,
+	handle func(ctx context.Context, update tgbotapi.Update)) *dispatcher {
+
+	if workers <= 0 {
+		workers = defaultUpdateWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultUpdateQueueSize
+	}
+
+	d := &dispatcher{
+		queues: make([]chan dispatchItem, workers),
+		handle: handle,
+	}
+	d.wg.Add(workers)
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchItem, queueSize)
+		go d.worker(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *dispatcher) worker(queue <-chan dispatchItem) {
+	defer d.wg.Done()
+
+	for item := range queue {
+		// Метрики: размер очереди и время ожидания в ней
+		observability.UpdatesQueueSize.Dec()
+		observability.HistogramUpdatesQueueTime.Observe(time.Since(item.enqueuedAt).Seconds())
+
+		// Сообщения из очереди дообрабатываются и после завершения контекста слушателя
+		d.handle(context.Background(), item.update)
+	}
+}
+
+// Dispatch ставит обновление в очередь воркера пользователя userID.
+// Если очередь заполнена, ждет освобождения места или завершения контекста
+func (d *dispatcher) Dispatch(ctx context.Context, userID int64, update tgbotapi.Update) bool {
+	queue := d.queues[uint64(userID)%uint64(len(d.queues))]
+	item := dispatchItem{
+		update:     update,
+		enqueuedAt: time.Now(),
+	}
+
+	// Метрики: размер очереди, увеличивается до отправки, чтобы воркер не ушел в минус
+	observability.UpdatesQueueSize.Inc()
+
+	select {
+	case queue <- item:
+		return true
+	default:
+	}
+
+	// Метрики: очередь воркера заполнена, чтение обновлений приостановлено
+	observability.UpdatesQueueFullCount.Inc()
+
+	select {
+	case queue <- item:
+		return true
+	case <-ctx.Done():
+		observability.UpdatesQueueSize.Dec()
+		observability.UpdatesDroppedCount.Inc()
+		return false
+	}
+}
+
+// Stop закрывает очереди и ждет обработки всех поставленных в них обновлений
+func (d *dispatcher) Stop() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
@@ -0,0 +1,117 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDispatcherTestUpdate(id int, userID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: id,
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+		},
+	}
+}
+
+// обновления одного пользователя обрабатываются в порядке поступления
+func TestDispatcher_Dispatch_ManyUsers_OrderPreservedPerUser(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	processed := make(map[int64][]int)
+	d := newDispatcher(4, 2, func(ctx context.Context, update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		userID := update.Message.From.ID
+		processed[userID] = append(processed[userID], update.UpdateID)
+	})
+
+	// Act
+	for i := 0; i < 100; i++ {
+		userID := int64(i % 10)
+		d.Dispatch(context.Background(), userID, newDispatcherTestUpdate(i, userID))
+	}
+	d.Stop()
+
+	// Assert
+	assert.Len(t, processed, 10)
+	for userID, ids := range processed {
+		assert.Len(t, ids, 10)
+		for i, id := range ids {
+			assert.Equal(t, i*10+int(userID), id)
+		}
+	}
+}
+
+// медленная обработка одного пользователя не блокирует других
+func TestDispatcher_Dispatch_SlowUser_OtherUsersNotBlocked(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	d := newDispatcher(2, 1, func(ctx context.Context, update tgbotapi.Update) {
+		if update.Message.From.ID == 0 {
+			<-release
+		} else {
+			close(fastDone)
+		}
+	})
+
+	// Act
+	d.Dispatch(context.Background(), 0, newDispatcherTestUpdate(1, 0))
+	d.Dispatch(context.Background(), 1, newDispatcherTestUpdate(2, 1))
+
+	// Assert
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Error("fast user blocked by slow user")
+	}
+	close(release)
+	d.Stop()
+}
+
+// при остановке обрабатываются все поставленные в очередь обновления
+func TestDispatcher_Stop_QueuedUpdates_AllProcessed(t *testing.T) {
+	// Arrange
+	var count int32
+	d := newDispatcher(1, 10, func(ctx context.Context, update tgbotapi.Update) {
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&count, 1)
+	})
+	for i := 0; i < 10; i++ {
+		d.Dispatch(context.Background(), 1, newDispatcherTestUpdate(i, 1))
+	}
+
+	// Act
+	d.Stop()
+
+	// Assert
+	assert.Equal(t, int32(10), atomic.LoadInt32(&count))
+}
+
+// при заполненной очереди и завершенном контексте обновление отбрасывается
+func TestDispatcher_Dispatch_FullQueueCanceledContext_ReturnFalse(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	d := newDispatcher(1, 1, func(ctx context.Context, update tgbotapi.Update) {
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Dispatch(ctx, 1, newDispatcherTestUpdate(1, 1))
+	d.Dispatch(ctx, 1, newDispatcherTestUpdate(2, 1))
+	cancel()
+
+	// Act
+	ok := d.Dispatch(ctx, 1, newDispatcherTestUpdate(3, 1))
+
+	// Assert
+	assert.False(t, ok)
+	close(release)
+	d.Stop()
+}
@@ -0,0 +1,332 @@
+package tg
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrOutboxFull   = errors.New("outgoing queue is full")
+	ErrOutboxClosed = errors.New("outgoing queue is closed")
+)
+
+const (
+	defaultSendRateGlobal  = 30
+	defaultSendRatePerChat = 1
+	defaultSendQueueSize   = 1000
+	defaultSendMaxRetries  = 3
+
+	sendRetryBaseDelay = 500 * time.Millisecond
+	sendRetryMaxDelay  = 30 * time.Second
+
+	// Размер карты лимитов по чатам, после которого удаляются неактивные
+	chatBucketsPruneSize = 1000
+)
+
+// tokenBucket ограничивает частоту отправки. Токены можно взять в долг:
+// reserve возвращает время, которое нужно подождать перед отправкой
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.refill(now)
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// pause забирает все токены на время d, например по retry_after от телеграма
+func (tb *tokenBucket) pause(now time.Time, d time.Duration) {
+	tb.refill(now)
+	tb.tokens = -d.Seconds() * tb.rate
+}
+
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.refill(now)
+	return tb.tokens >= tb.burst
+}
+
+type OutboxOptions struct {
+	RateGlobal  float64
+	RatePerChat float64
+	QueueSize   int
+	MaxRetries  int
+}
+
+type outgoingResult struct {
+	message tgbotapi.Message
+	err     error
+}
+
+type outgoingMessage struct {
+	chatID int64
+	msg    tgbotapi.Chattable
+	result chan outgoingResult
+}
+
+// Очередь сообщений одного чата. Сообщения чата отправляются по порядку
+// отдельной горутиной, которая живет, пока в очереди есть сообщения
+type chatQueue struct {
+	bucket  *tokenBucket
+	pending []*outgoingMessage
+	active  bool
+}
+
+// outbox - очередь исходящих сообщений с общим лимитом и лимитом на чат.
+// У каждого чата своя очередь, поэтому ожидание лимита или паузы retry_after
+// одного чата не задерживает сообщения в другие чаты.
+// Ошибки 429 и сетевые ошибки повторяются
+type outbox struct {
+	send        func(tgbotapi.Chattable) (tgbotapi.Message, error)
+	ratePerChat float64
+	queueSize   int
+	maxRetries  int
+	sleep       func(time.Duration)
+
+	mu     sync.Mutex
+	global *tokenBucket
+	chats  map[int64]*chatQueue
+	queued int
+	closed bool
+	// Горутины чатов
+	workers sync.WaitGroup
+}
+
+func newOutbox(options OutboxOptions, send func(tgbotapi.Chattable) (tgbotapi.Message, error)) *outbox {
+	if options.RateGlobal <= 0 {
+		options.RateGlobal = defaultSendRateGlobal
+	}
+	if options.RatePerChat <= 0 {
+		options.RatePerChat = defaultSendRatePerChat
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultSendQueueSize
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = defaultSendMaxRetries
+	}
+
+	return &outbox{
+		send:        send,
+		ratePerChat: options.RatePerChat,
+		queueSize:   options.QueueSize,
+		maxRetries:  options.MaxRetries,
+		sleep:       time.Sleep,
+		global:      newTokenBucket(options.RateGlobal, time.Now()),
+		chats:       make(map[int64]*chatQueue),
+	}
+}
+
+// Send ставит сообщение в очередь чата и ждет результата отправки.
+// При завершении контекста сообщение остается в очереди и будет отправлено
+func (o *outbox) Send(ctx context.Context, chatID int64, msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	out := &outgoingMessage{
+		chatID: chatID,
+		msg:    msg,
+		result: make(chan outgoingResult, 1),
+	}
+
+	if err := o.enqueue(out); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	select {
+	case res := <-out.result:
+		return res.message, res.err
+	case <-ctx.Done():
+		return tgbotapi.Message{}, ctx.Err()
+	}
+}
+
+func (o *outbox) enqueue(out *outgoingMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		observability.OutgoingDroppedCountVec.WithLabelValues("closed").Inc()
+		return ErrOutboxClosed
+	}
+	if o.queued >= o.queueSize {
+		// Метрики: очередь переполнена, сообщение отброшено
+		observability.OutgoingDroppedCountVec.WithLabelValues("queue_full").Inc()
+		return ErrOutboxFull
+	}
+
+	now := time.Now()
+	chat, inMap := o.chats[out.chatID]
+	if !inMap {
+		if len(o.chats) >= chatBucketsPruneSize {
+			o.pruneChats(now)
+		}
+		chat = &chatQueue{bucket: newTokenBucket(o.ratePerChat, now)}
+		o.chats[out.chatID] = chat
+	}
+	chat.pending = append(chat.pending, out)
+	o.queued++
+	if !chat.active {
+		chat.active = true
+		o.workers.Add(1)
+		go o.runChat(chat)
+	}
+
+	// Метрики: сообщение поставлено в очередь
+	observability.OutgoingQueuedCount.Inc()
+	observability.OutgoingQueueSize.Inc()
+	return nil
+}
+
+// Close перестает принимать сообщения и ждет отправки уже поставленных в очередь
+func (o *outbox) Close() {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	o.workers.Wait()
+}
+
+// runChat отправляет сообщения чата, пока его очередь не опустеет
+func (o *outbox) runChat(chat *chatQueue) {
+	defer o.workers.Done()
+
+	for {
+		o.mu.Lock()
+		if len(chat.pending) == 0 {
+			chat.active = false
+			o.mu.Unlock()
+			return
+		}
+		out := chat.pending[0]
+		chat.pending[0] = nil
+		chat.pending = chat.pending[1:]
+		o.queued--
+		o.mu.Unlock()
+
+		o.process(chat, out)
+	}
+}
+
+func (o *outbox) process(chat *chatQueue, out *outgoingMessage) {
+	observability.OutgoingQueueSize.Dec()
+
+	var res outgoingResult
+	for attempt := 0; ; attempt++ {
+		o.wait(chat)
+
+		res.message, res.err = o.send(out.msg)
+		if res.err == nil {
+			break
+		}
+
+		delay, reason, retry := o.retryDelay(chat, res.err, attempt)
+		if !retry {
+			break
+		}
+		if attempt >= o.maxRetries {
+			// Метрики: попытки исчерпаны, сообщение потеряно
+			observability.OutgoingDroppedCountVec.WithLabelValues("retries_exceeded").Inc()
+			break
+		}
+		// Метрики: повторная отправка
+		observability.OutgoingRetryCountVec.WithLabelValues(reason).Inc()
+		if delay > 0 {
+			o.sleep(delay)
+		}
+	}
+
+	out.result <- res
+}
+
+// wait ждет, пока отправку разрешат общий лимит и лимит чата.
+// Ждет только горутина чата, остальные чаты отправляют сообщения в это время
+func (o *outbox) wait(chat *chatQueue) {
+	o.mu.Lock()
+	now := time.Now()
+	delay := o.global.reserve(now)
+	if chatDelay := chat.bucket.reserve(now); chatDelay > delay {
+		delay = chatDelay
+	}
+	o.mu.Unlock()
+
+	if delay > 0 {
+		o.sleep(delay)
+	}
+}
+
+// pruneChats удаляет простаивающие чаты без сообщений в очереди
+func (o *outbox) pruneChats(now time.Time) {
+	for chatID, chat := range o.chats {
+		if !chat.active && chat.bucket.full(now) {
+			delete(o.chats, chatID)
+		}
+	}
+}
+
+// retryDelay определяет, нужно ли повторять отправку и через какое время.
+// На 429 телеграм сообщает retry_after, на это время чат ставится на паузу
+// и задержку выдерживает лимит чата. retry_after не уменьшается: отправка
+// раньше срока снова получит 429
+func (o *outbox) retryDelay(chat *chatQueue, err error, attempt int) (time.Duration, string, bool) {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		switch {
+		case tgErr.Code == http.StatusTooManyRequests:
+			delay := time.Duration(tgErr.RetryAfter) * time.Second
+			if delay <= 0 {
+				delay = backoffDelay(attempt)
+			}
+			o.mu.Lock()
+			chat.bucket.pause(time.Now(), delay)
+			o.mu.Unlock()
+			return 0, "retry_after", true
+		case tgErr.Code >= http.StatusInternalServerError:
+		default:
+			// Ошибки запроса (400, 403 и т.д.) повторять бесполезно
+			return 0, "", false
+		}
+	}
+
+	return backoffDelay(attempt), "error", true
+}
+
+func backoffDelay(attempt int) time.Duration {
+	delay := sendRetryBaseDelay << attempt
+	if delay > sendRetryMaxDelay || delay <= 0 {
+		delay = sendRetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,173 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSender отвечает заданными ошибками, затем успешно
+type fakeSender struct {
+	sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (fs *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	fs.calls++
+	if len(fs.errs) > 0 {
+		err := fs.errs[0]
+		fs.errs = fs.errs[1:]
+		return tgbotapi.Message{}, err
+	}
+	return tgbotapi.Message{MessageID: fs.calls}, nil
+}
+
+func (fs *fakeSender) Calls() int {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.calls
+}
+
+func newTestOutbox(options OutboxOptions, sender *fakeSender) (*outbox, *[]time.Duration) {
+	o := newOutbox(options, sender.Send)
+	var mu sync.Mutex
+	var sleeps []time.Duration
+	o.sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		sleeps = append(sleeps, d)
+	}
+	return o, &sleeps
+}
+
+func Test_Outbox_Send_Success_ShouldReturnMessage(t *testing.T) {
+	sender := &fakeSender{}
+	o, _ := newTestOutbox(OutboxOptions{}, sender)
+	defer o.Close()
+
+	msg, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, msg.MessageID)
+}
+
+func Test_Outbox_Send_TooManyRequests_ShouldRetryAfter(t *testing.T) {
+	sender := &fakeSender{errs: []error{
+		&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 3}},
+	}}
+	o, sleeps := newTestOutbox(OutboxOptions{RatePerChat: 1}, sender)
+	defer o.Close()
+
+	_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sender.Calls())
+	// лимит чата выдерживает паузу retry_after перед повторной отправкой
+	if assert.Len(t, *sleeps, 1) {
+		assert.GreaterOrEqual(t, (*sleeps)[0], 3*time.Second)
+	}
+}
+
+// retry_after больше максимальной задержки повторов не уменьшается
+func Test_Outbox_Send_TooManyRequests_ShouldNotClampRetryAfter(t *testing.T) {
+	sender := &fakeSender{errs: []error{
+		&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 120}},
+	}}
+	o, sleeps := newTestOutbox(OutboxOptions{RatePerChat: 1}, sender)
+	defer o.Close()
+
+	_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.NoError(t, err)
+	if assert.Len(t, *sleeps, 1) {
+		assert.GreaterOrEqual(t, (*sleeps)[0], 120*time.Second)
+	}
+}
+
+// пауза retry_after одного чата не задерживает сообщения в другие чаты
+func Test_Outbox_Send_RateLimitedChat_ShouldNotDelayOtherChats(t *testing.T) {
+	sender := &fakeSender{errs: []error{
+		&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 60}},
+	}}
+	o := newOutbox(OutboxOptions{}, sender.Send)
+	paused := make(chan struct{})
+	release := make(chan struct{})
+	o.sleep = func(d time.Duration) {
+		close(paused)
+		<-release
+	}
+
+	limited := make(chan error, 1)
+	go func() {
+		_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "limited"))
+		limited <- err
+	}()
+	<-paused
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := o.Send(ctx, 2, tgbotapi.NewMessage(2, "other"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, msg.MessageID)
+
+	close(release)
+	assert.NoError(t, <-limited)
+	o.Close()
+	assert.Equal(t, 3, sender.Calls())
+}
+
+func Test_Outbox_Send_BadRequest_ShouldNotRetry(t *testing.T) {
+	sender := &fakeSender{errs: []error{
+		&tgbotapi.Error{Code: 400, Message: "Bad Request"},
+	}}
+	o, _ := newTestOutbox(OutboxOptions{}, sender)
+	defer o.Close()
+
+	_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, sender.Calls())
+}
+
+func Test_Outbox_Send_NetworkErrors_ShouldRetryWithBackoff(t *testing.T) {
+	netErr := errors.New("connection reset")
+	sender := &fakeSender{errs: []error{netErr, netErr, netErr, netErr}}
+	o, sleeps := newTestOutbox(OutboxOptions{RateGlobal: 1000, RatePerChat: 1000, MaxRetries: 2}, sender)
+	defer o.Close()
+
+	_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.Equal(t, netErr, err)
+	assert.Equal(t, 3, sender.Calls())
+	assert.Equal(t, []time.Duration{sendRetryBaseDelay, 2 * sendRetryBaseDelay}, *sleeps)
+}
+
+func Test_Outbox_Send_Closed_ShouldReturnError(t *testing.T) {
+	o, _ := newTestOutbox(OutboxOptions{}, &fakeSender{})
+	o.Close()
+
+	_, err := o.Send(context.Background(), 1, tgbotapi.NewMessage(1, "text"))
+
+	assert.Equal(t, ErrOutboxClosed, err)
+}
+
+// сообщения сверх лимита ждут освобождения токенов
+func Test_TokenBucket_Reserve_OverLimit_ShouldWait(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(1, now)
+
+	assert.Equal(t, time.Duration(0), tb.reserve(now))
+	assert.Equal(t, time.Second, tb.reserve(now))
+	assert.Equal(t, 2*time.Second, tb.reserve(now))
+	assert.Equal(t, time.Second, tb.reserve(now.Add(2*time.Second)))
+}
@@ -2,6 +2,9 @@ package tg
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"sync"
 
 	"github.com/cr00z/goSpendingBot/internal/model/messages"
@@ -12,34 +15,106 @@ import (
 	"go.uber.org/zap"
 )
 
-type TokenGetter interface {
+// Максимальный размер принимаемого от юзера файла
+const maxDocumentSize = 5 << 20
+
+var ErrDocumentTooLarge = errors.New("document is too large")
+
+// Адрес скачивания файлов, переопределяется в тестах
+var fileEndpoint = tgbotapi.FileEndpoint
+
+type ConfigGetter interface {
 	Token() string
+	UpdateWorkers() int
+	UpdateQueueSize() int
+	SendRateGlobal() float64
+	SendRatePerChat() float64
+	SendQueueSize() int
+	SendMaxRetries() int
 }
 
 type Client struct {
-	client *tgbotapi.BotAPI
-	logger *zap.Logger
+	client          *tgbotapi.BotAPI
+	logger          *zap.Logger
+	updateWorkers   int
+	updateQueueSize int
+	outbox          *outbox
 }
 
-func New(tokenGetter TokenGetter, logger *zap.Logger) (*Client, error) {
-	client, err := tgbotapi.NewBotAPI(tokenGetter.Token())
+func New(configGetter ConfigGetter, logger *zap.Logger) (*Client, error) {
+	client, err := tgbotapi.NewBotAPI(configGetter.Token())
 	if err != nil {
 		return nil, errors.Wrap(err, "NewBotAPI")
 	}
 
 	return &Client{
-		client: client,
-		logger: logger,
+		client:          client,
+		logger:          logger,
+		updateWorkers:   configGetter.UpdateWorkers(),
+		updateQueueSize: configGetter.UpdateQueueSize(),
+		outbox: newOutbox(OutboxOptions{
+			RateGlobal:  configGetter.SendRateGlobal(),
+			RatePerChat: configGetter.SendRatePerChat(),
+			QueueSize:   configGetter.SendQueueSize(),
+			MaxRetries:  configGetter.SendMaxRetries(),
+		}, client.Send),
 	}, nil
 }
 
+// Close дожидается отправки сообщений из очереди
+func (c *Client) Close() {
+	c.outbox.Close()
+}
+
 func (c *Client) SendMessage(ctx context.Context, text string, userID int64) error {
+	_, err := c.SendMessageWithID(ctx, text, userID)
+	return err
+}
+
+// SendMessageWithID отправляет сообщение и возвращает его id в чате юзера
+func (c *Client) SendMessageWithID(ctx context.Context, text string, userID int64) (int, error) {
 	span, _ := opentracing.StartSpanFromContext(ctx, "send message")
 	defer span.Finish()
 
 	msg := tgbotapi.NewMessage(userID, text)
 	msg.ParseMode = "markdown"
-	_, err := c.client.Send(msg)
+	sent, err := c.outbox.Send(ctx, userID, msg)
+
+	ext.Error.Set(span, err != nil)
+
+	if err != nil {
+		return 0, errors.Wrap(err, "client.Send")
+	}
+	return sent.MessageID, nil
+}
+
+// EditMessage заменяет текст сообщения messageID в чате юзера
+func (c *Client) EditMessage(ctx context.Context, text string, userID int64, messageID int) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "edit message")
+	defer span.Finish()
+
+	msg := tgbotapi.NewEditMessageText(userID, messageID, text)
+	msg.ParseMode = "markdown"
+	_, err := c.outbox.Send(ctx, userID, msg)
+
+	ext.Error.Set(span, err != nil)
+
+	if err != nil {
+		return errors.Wrap(err, "client.Send")
+	}
+	return nil
+}
+
+// SendDocument отправляет юзеру файл с именем name
+func (c *Client) SendDocument(ctx context.Context, name string, data []byte, userID int64) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "send document")
+	defer span.Finish()
+
+	msg := tgbotapi.NewDocument(userID, tgbotapi.FileBytes{
+		Name:  name,
+		Bytes: data,
+	})
+	_, err := c.outbox.Send(ctx, userID, msg)
 
 	ext.Error.Set(span, err != nil)
 
@@ -49,42 +124,150 @@ func (c *Client) SendMessage(ctx context.Context, text string, userID int64) err
 	return nil
 }
 
+// downloadDocument скачивает присланный юзером файл
+func (c *Client) downloadDocument(ctx context.Context, document *tgbotapi.Document) ([]byte, error) {
+	if document.FileSize > maxDocumentSize {
+		return nil, ErrDocumentTooLarge
+	}
+
+	file, err := c.client.GetFile(tgbotapi.FileConfig{FileID: document.FileID})
+	if err != nil {
+		return nil, errors.Wrap(err, "GetFile")
+	}
+
+	url := fmt.Sprintf(fileEndpoint, c.client.Token, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	resp, err := c.client.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "download file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("download file: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "read file")
+	}
+	if len(data) > maxDocumentSize {
+		return nil, ErrDocumentTooLarge
+	}
+	return data, nil
+}
+
 func (c *Client) ListenUpdates(ctx context.Context, wg *sync.WaitGroup, msgModel *messages.Model) {
 	wg.Add(1)
 	defer wg.Done()
 
+	// Long polling не работает при установленном вебхуке
+	if _, err := c.client.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		c.logger.Warn("delete webhook failed", zap.Error(err))
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
 	updates := c.client.GetUpdatesChan(u)
 	c.logger.Info("listening for messages")
 
+	c.processUpdates(ctx, updates, msgModel)
+}
+
+// processUpdates распределяет входящие сообщения по воркерам до завершения
+// контекста, после чего дожидается обработки уже принятых сообщений
+func (c *Client) processUpdates(ctx context.Context,
+	updates <-chan tgbotapi.Update, msgModel *messages.Model) {
+
+	d := newDispatcher(c.updateWorkers, c.updateQueueSize,
+		func(ctx context.Context, update tgbotapi.Update) {
+			c.handleUpdate(ctx, update, msgModel)
+		},
+	)
+
 LOOP:
 	for {
 		select {
 		case update := <-updates:
-			if update.Message != nil {
-				c.logger.Info(
-					"command received",
-					zap.String("username", update.Message.From.UserName),
-					zap.String("text", update.Message.Text),
-				)
-
-				err := msgModel.IncomingMessage(ctx, messages.Message{
-					Text:   update.Message.Text,
-					UserID: update.Message.From.ID,
-				})
-
-				if err != nil {
-					c.logger.Warn(
-						"error processing message:",
-						zap.Error(err),
-					)
-				}
+			if update.Message == nil {
+				continue
+			}
+			if userID, ok := messageUserID(update.Message); ok {
+				d.Dispatch(ctx, userID, update)
 			}
 		case <-ctx.Done():
 			c.logger.Info("shutdown listen updates")
 			break LOOP
 		}
 	}
+
+	d.Stop()
+	c.logger.Info("updates queue drained")
+}
+
+// messageUserID возвращает, от чьего имени ведется учет трат. У сообщений
+// от имени канала или группы From не задан, тогда учет ведется на чат
+func messageUserID(message *tgbotapi.Message) (int64, bool) {
+	if message.From != nil {
+		return message.From.ID, true
+	}
+	if message.Chat != nil {
+		return message.Chat.ID, true
+	}
+	return 0, false
+}
+
+func (c *Client) handleUpdate(ctx context.Context, update tgbotapi.Update, msgModel *messages.Model) {
+	if update.Message == nil {
+		return
+	}
+	userID, ok := messageUserID(update.Message)
+	if !ok {
+		return
+	}
+
+	var userName string
+	if update.Message.From != nil {
+		userName = update.Message.From.UserName
+	}
+	c.logger.Info(
+		"command received",
+		zap.String("username", userName),
+		zap.String("text", update.Message.Text),
+	)
+
+	msg := messages.Message{
+		Text:   update.Message.Text,
+		UserID: userID,
+	}
+	if update.Message.Document != nil {
+		// Команда к файлу передается в подписи
+		msg.Text = update.Message.Caption
+	}
+	// Скачиваем только резервную копию, на остальные файлы отвечаем по подписи
+	if update.Message.Document != nil && messages.IsRestoreCommand(msg.Text) {
+		document, err := c.downloadDocument(ctx, update.Message.Document)
+		if err != nil {
+			c.logger.Warn("document download failed", zap.Error(err))
+			text := "File download error, try again later"
+			if errors.Is(err, ErrDocumentTooLarge) {
+				text = "File is too large"
+			}
+			_ = c.SendMessage(ctx, text, msg.UserID)
+			return
+		}
+		msg.Document = document
+	}
+
+	err := msgModel.IncomingMessage(ctx, msg)
+
+	if err != nil {
+		c.logger.Warn(
+			"error processing message:",
+			zap.Error(err),
+		)
+	}
 }
@@ -0,0 +1,165 @@
+package tg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/cr00z/goSpendingBot/internal/model/messages"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newDownloadTestClient(t *testing.T, content string) *Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottoken/getFile", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"file_id":"id","file_path":"documents/backup.json"}}`))
+	})
+	mux.HandleFunc("/file/bottoken/documents/backup.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(content))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	oldEndpoint := fileEndpoint
+	fileEndpoint = srv.URL + "/file/bot%s/%s"
+	t.Cleanup(func() { fileEndpoint = oldEndpoint })
+
+	bot := &tgbotapi.BotAPI{Token: "token", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+	return &Client{
+		client: bot,
+		logger: zap.NewNop(),
+	}
+}
+
+// присланный файл скачивается по пути, полученному через getFile
+func TestClient_DownloadDocument_ShouldReturnContent(t *testing.T) {
+	c := newDownloadTestClient(t, `{"version":1}`)
+
+	data, err := c.downloadDocument(context.Background(), &tgbotapi.Document{FileID: "id", FileSize: 13})
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":1}`, string(data))
+}
+
+// слишком большой файл не скачивается
+func TestClient_DownloadDocument_TooLarge_ShouldReject(t *testing.T) {
+	c := newDownloadTestClient(t, "")
+
+	_, err := c.downloadDocument(context.Background(), &tgbotapi.Document{FileID: "id", FileSize: maxDocumentSize + 1})
+
+	assert.ErrorIs(t, err, ErrDocumentTooLarge)
+}
+
+// отправленное сообщение возвращает id, по которому оно заменяется
+func TestClient_EditMessage_ShouldEditSentMessage(t *testing.T) {
+	var editForm map[string][]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottoken/sendMessage", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":123}}}`))
+	})
+	mux.HandleFunc("/bottoken/editMessageText", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		editForm = r.PostForm
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":123}}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	bot := &tgbotapi.BotAPI{Token: "token", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+	c := &Client{client: bot, logger: zap.NewNop(), outbox: newOutbox(OutboxOptions{}, bot.Send)}
+	defer c.Close()
+
+	messageID, err := c.SendMessageWithID(context.Background(), "Preparing report…", 123)
+	require.NoError(t, err)
+	err = c.EditMessage(context.Background(), "*Report:* empty", 123, messageID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 42, messageID)
+	if assert.NotNil(t, editForm) {
+		assert.Equal(t, []string{"123"}, editForm["chat_id"])
+		assert.Equal(t, []string{"42"}, editForm["message_id"])
+		assert.Equal(t, []string{"*Report:* empty"}, editForm["text"])
+	}
+}
+
+// файл без подписи /restore не скачивается, на него отвечают как на обычное сообщение
+func TestClient_HandleUpdate_DocumentWithoutRestore_ShouldNotDownload(t *testing.T) {
+	var downloaded bool
+	var sent []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottoken/getFile", func(w http.ResponseWriter, r *http.Request) {
+		downloaded = true
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"file_id":"id","file_path":"documents/backup.json"}}`))
+	})
+	mux.HandleFunc("/bottoken/sendMessage", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		sent = append(sent, r.PostForm.Get("text"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":123}}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	bot := &tgbotapi.BotAPI{Token: "token", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+	c := &Client{client: bot, logger: zap.NewNop(), outbox: newOutbox(OutboxOptions{}, bot.Send)}
+	defer c.Close()
+	msgModel := messages.New(c, nil, nil, nil, nil, nil)
+
+	for _, caption := range []string{"", "photo of receipt"} {
+		c.handleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+			From:     &tgbotapi.User{ID: 123},
+			Chat:     &tgbotapi.Chat{ID: 123},
+			Caption:  caption,
+			Document: &tgbotapi.Document{FileID: "id", FileSize: 13},
+		}}, msgModel)
+	}
+
+	assert.False(t, downloaded)
+	assert.Len(t, sent, 2)
+}
+
+// сообщение без отправителя (от имени канала или группы) учитывается на чат,
+// а сообщение без отправителя и чата пропускается
+func TestClient_ProcessUpdates_MessageWithoutFrom_ShouldAnswerToChat(t *testing.T) {
+	var mu sync.Mutex
+	var chats []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bottoken/sendMessage", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		chats = append(chats, r.PostForm.Get("chat_id"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":-100555}}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	bot := &tgbotapi.BotAPI{Token: "token", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+	c := &Client{client: bot, logger: zap.NewNop(), outbox: newOutbox(OutboxOptions{}, bot.Send)}
+	defer c.Close()
+	msgModel := messages.New(c, nil, nil, nil, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.processUpdates(ctx, updates, msgModel)
+	}()
+	updates <- tgbotapi.Update{Message: &tgbotapi.Message{Text: "hello"}}
+	updates <- tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: -100555},
+		Text: "hello",
+	}}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"-100555"}, chats)
+}
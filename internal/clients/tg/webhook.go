@@ -0,0 +1,154 @@
+package tg
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/model/messages"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// Заголовок, в котором телеграм передает secret_token вебхука
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	webhookBufferSize      = 100
+	webhookShutdownTimeout = 5 * time.Second
+)
+
+type WebhookOptions struct {
+	URL         string
+	ListenAddr  string
+	SecretToken string
+	CertFile    string
+	KeyFile     string
+}
+
+// ListenWebhook регистрирует вебхук в телеграме и принимает обновления
+// через HTTP(S) сервер до завершения контекста или ошибки сервера
+func (c *Client) ListenWebhook(ctx context.Context, wg *sync.WaitGroup,
+	msgModel *messages.Model, options WebhookOptions) error {
+
+	wg.Add(1)
+	defer wg.Done()
+
+	webhookURL, err := url.Parse(options.URL)
+	if err != nil {
+		return errors.Wrap(err, "wrong webhook url")
+	}
+
+	err = c.setWebhook(options)
+	if err != nil {
+		return err
+	}
+
+	updates := make(chan tgbotapi.Update, webhookBufferSize)
+
+	// Обработка останавливается и при завершении контекста, и при ошибке сервера
+	serveCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath(webhookURL), c.webhookHandler(serveCtx, options.SecretToken, updates))
+	srv := &http.Server{
+		Addr:    options.ListenAddr,
+		Handler: mux,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if options.CertFile != "" && options.KeyFile != "" {
+			err = srv.ListenAndServeTLS(options.CertFile, options.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			c.logger.Error("webhook server failed", zap.Error(err))
+			serveErr <- errors.Wrap(err, "webhook server")
+			stop()
+		}
+	}()
+	c.logger.Info("listening for webhook", zap.String("addr", options.ListenAddr))
+
+	c.processUpdates(serveCtx, updates, msgModel)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		c.logger.Warn("webhook server shutdown failed", zap.Error(err))
+	}
+
+	select {
+	case err = <-serveErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// setWebhook регистрирует вебхук. Параметры передаются напрямую, так как
+// tgbotapi.WebhookConfig не поддерживает secret_token
+func (c *Client) setWebhook(options WebhookOptions) error {
+	params := make(tgbotapi.Params)
+	params["url"] = options.URL
+	params.AddNonEmpty("secret_token", options.SecretToken)
+
+	var err error
+	if options.CertFile != "" {
+		// Самоподписанный сертификат нужно передать телеграму
+		_, err = c.client.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(options.CertFile),
+		}})
+	} else {
+		_, err = c.client.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return errors.Wrap(err, "setWebhook")
+	}
+	return nil
+}
+
+// webhookHandler проверяет secret_token и передает обновление в общий цикл обработки.
+// После завершения ctx обновления не принимаются, телеграм повторит их доставку
+func (c *Client) webhookHandler(ctx context.Context, secretToken string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secretToken != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(secretToken)) != 1 {
+			c.logger.Warn("webhook request with wrong secret token", zap.String("remote", r.RemoteAddr))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		update, err := c.client.HandleUpdate(r)
+		if err != nil {
+			c.logger.Warn("wrong webhook request", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- *update:
+			w.WriteHeader(http.StatusOK)
+		case <-ctx.Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			// Телеграм повторит доставку обновления
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func webhookPath(webhookURL *url.URL) string {
+	if webhookURL.Path == "" {
+		return "/"
+	}
+	return webhookURL.Path
+}
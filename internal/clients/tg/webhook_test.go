@@ -0,0 +1,90 @@
+package tg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const webhookTestBody = `{"update_id":1,"message":{"message_id":2,"from":{"id":123},"text":"/start"}}`
+
+func newWebhookTestClient() *Client {
+	return &Client{
+		client: &tgbotapi.BotAPI{},
+		logger: zap.NewNop(),
+	}
+}
+
+func Test_WebhookHandler_ValidSecretToken_ShouldPassUpdate(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := newWebhookTestClient().webhookHandler(context.Background(), "secret", updates)
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(webhookTestBody))
+	req.Header.Set(secretTokenHeader, "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, updates, 1) {
+		update := <-updates
+		assert.Equal(t, "/start", update.Message.Text)
+		assert.Equal(t, int64(123), update.Message.From.ID)
+	}
+}
+
+func Test_WebhookHandler_WrongSecretToken_ShouldReject(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := newWebhookTestClient().webhookHandler(context.Background(), "secret", updates)
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(webhookTestBody))
+	req.Header.Set(secretTokenHeader, "wrong")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Len(t, updates, 0)
+}
+
+func Test_WebhookHandler_EmptyBody_ShouldReject(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := newWebhookTestClient().webhookHandler(context.Background(), "", updates)
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, updates, 0)
+}
+
+func Test_WebhookHandler_Shutdown_ShouldNotWaitForQueue(t *testing.T) {
+	// Очередь заполнена, обработка остановлена
+	updates := make(chan tgbotapi.Update)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler := newWebhookTestClient().webhookHandler(ctx, "", updates)
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(webhookTestBody))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func Test_WebhookHandler_WrongMethod_ShouldReject(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := newWebhookTestClient().webhookHandler(context.Background(), "", updates)
+
+	req := httptest.NewRequest(http.MethodGet, "/telegram", strings.NewReader(webhookTestBody))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, updates, 0)
+}
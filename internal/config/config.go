@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -9,10 +10,58 @@ import (
 
 const configFile = "build/bot/config.yaml"
 
+const (
+	UpdatesModePolling = "polling"
+	UpdatesModeWebhook = "webhook"
+)
+
+const (
+	ReportsKafka = "kafka"
+	ReportsLocal = "local"
+)
+
+const (
+	CacheBackendLocal = "local"
+	CacheBackendRedis = "redis"
+)
+
 type Config struct {
-	Token             string `yaml:"token"`
-	CurrencyCacheSize int    `yaml:"currency_cache_size"`
-	ReportCacheSize   int    `yaml:"report_cache_size"`
+	Token               string        `yaml:"token"`
+	Storage             string        `yaml:"storage"`
+	SqlitePath          string        `yaml:"sqlite_path"`
+	Reports             string        `yaml:"reports"`
+	CurrencyCacheSize   int           `yaml:"currency_cache_size"`
+	ReportCacheSize     int           `yaml:"report_cache_size"`
+	CurrencyCacheTTL    time.Duration `yaml:"currency_cache_ttl"`
+	ReportCacheTTL      time.Duration `yaml:"report_cache_ttl"`
+	CacheShards         int           `yaml:"cache_shards"`
+	CurrencyCachePolicy string        `yaml:"currency_cache_policy"`
+	ReportCachePolicy   string        `yaml:"report_cache_policy"`
+	CacheBackend        string        `yaml:"cache_backend"`
+	Redis               Redis         `yaml:"redis"`
+	UpdatesMode         string        `yaml:"updates_mode"`
+	Webhook             Webhook       `yaml:"webhook"`
+	UpdateWorkers       int           `yaml:"update_workers"`
+	UpdateQueueSize     int           `yaml:"update_queue_size"`
+	SendRateGlobal      float64       `yaml:"send_rate_global"`
+	SendRatePerChat     float64       `yaml:"send_rate_per_chat"`
+	SendQueueSize       int           `yaml:"send_queue_size"`
+	SendMaxRetries      int           `yaml:"send_max_retries"`
+}
+
+type Webhook struct {
+	URL         string `yaml:"url"`
+	ListenAddr  string `yaml:"listen_addr"`
+	SecretToken string `yaml:"secret_token"`
+	CertFile    string `yaml:"cert_file"`
+	KeyFile     string `yaml:"key_file"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	Prefix   string `yaml:"prefix"`
 }
 
 type Service struct {
@@ -32,6 +81,57 @@ func New() (*Service, error) {
 		return nil, errors.Wrap(err, "parsing yaml")
 	}
 
+	switch s.config.UpdatesMode {
+	case "":
+		s.config.UpdatesMode = UpdatesModePolling
+	case UpdatesModePolling:
+	case UpdatesModeWebhook:
+		if s.config.Webhook.URL == "" || s.config.Webhook.ListenAddr == "" {
+			return nil, errors.New("webhook url and listen_addr must be set")
+		}
+	default:
+		return nil, errors.Errorf("unknown updates mode %q", s.config.UpdatesMode)
+	}
+
+	// report_service читает траты из postgres, с хранилищем в файле
+	// или в памяти бота рапорты может формировать только сам бот
+	localStorage := s.config.Storage == "sqlite" || s.config.Storage == "memory"
+	switch s.config.Reports {
+	case "":
+		s.config.Reports = ReportsKafka
+		if localStorage {
+			s.config.Reports = ReportsLocal
+		}
+	case ReportsKafka:
+		if localStorage {
+			return nil, errors.Errorf("storage %q requires reports: %s", s.config.Storage, ReportsLocal)
+		}
+	case ReportsLocal:
+	default:
+		return nil, errors.Errorf("unknown reports mode %q", s.config.Reports)
+	}
+
+	switch s.config.CacheBackend {
+	case "":
+		s.config.CacheBackend = CacheBackendLocal
+	case CacheBackendLocal:
+	case CacheBackendRedis:
+		if s.config.Redis.Addr == "" {
+			return nil, errors.New("redis addr must be set")
+		}
+		// Общий кэш в Redis поддерживает только lru без шардов
+		for _, policy := range []string{s.config.CurrencyCachePolicy, s.config.ReportCachePolicy} {
+			if policy != "" && policy != "lru" {
+				return nil, errors.Errorf("cache policy %q is not supported by redis cache backend, use lru", policy)
+			}
+		}
+		if s.config.CacheShards > 1 {
+			return nil, errors.New("cache_shards is not supported by redis cache backend")
+		}
+	default:
+		return nil, errors.Errorf("unknown cache backend %q", s.config.CacheBackend)
+	}
+
 	return s, nil
 }
 
@@ -39,6 +139,18 @@ func (s *Service) Token() string {
 	return s.config.Token
 }
 
+func (s *Service) Storage() string {
+	return s.config.Storage
+}
+
+func (s *Service) SqlitePath() string {
+	return s.config.SqlitePath
+}
+
+func (s *Service) Reports() string {
+	return s.config.Reports
+}
+
 func (s *Service) CurrencyCacheSize() int {
 	return s.config.CurrencyCacheSize
 }
@@ -46,3 +158,63 @@ func (s *Service) CurrencyCacheSize() int {
 func (s *Service) ReportCacheSize() int {
 	return s.config.ReportCacheSize
 }
+
+func (s *Service) CurrencyCacheTTL() time.Duration {
+	return s.config.CurrencyCacheTTL
+}
+
+func (s *Service) ReportCacheTTL() time.Duration {
+	return s.config.ReportCacheTTL
+}
+
+func (s *Service) CacheShards() int {
+	return s.config.CacheShards
+}
+
+func (s *Service) CurrencyCachePolicy() string {
+	return s.config.CurrencyCachePolicy
+}
+
+func (s *Service) ReportCachePolicy() string {
+	return s.config.ReportCachePolicy
+}
+
+func (s *Service) CacheBackend() string {
+	return s.config.CacheBackend
+}
+
+func (s *Service) Redis() Redis {
+	return s.config.Redis
+}
+
+func (s *Service) UpdatesMode() string {
+	return s.config.UpdatesMode
+}
+
+func (s *Service) Webhook() Webhook {
+	return s.config.Webhook
+}
+
+func (s *Service) UpdateWorkers() int {
+	return s.config.UpdateWorkers
+}
+
+func (s *Service) UpdateQueueSize() int {
+	return s.config.UpdateQueueSize
+}
+
+func (s *Service) SendRateGlobal() float64 {
+	return s.config.SendRateGlobal
+}
+
+func (s *Service) SendRatePerChat() float64 {
+	return s.config.SendRatePerChat
+}
+
+func (s *Service) SendQueueSize() int {
+	return s.config.SendQueueSize
+}
+
+func (s *Service) SendMaxRetries() int {
+	return s.config.SendMaxRetries
+}
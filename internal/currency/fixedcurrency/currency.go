@@ -0,0 +1,50 @@
+package fixedcurrency
+
+import (
+	"sort"
+
+	"github.com/cr00z/goSpendingBot/internal/currency"
+	"github.com/shopspring/decimal"
+)
+
+// FixedCurrencyStorage хранит заданные при создании курсы валют.
+// Используется для локального запуска без доступа к cbr.ru
+type FixedCurrencyStorage struct {
+	currencies map[string]decimal.Decimal
+}
+
+func NewFixedCurrencyStorage(currencies map[string]decimal.Decimal) *FixedCurrencyStorage {
+	fcs := &FixedCurrencyStorage{
+		currencies: make(map[string]decimal.Decimal, len(currencies)+1),
+	}
+	fcs.currencies["RUB"] = decimal.NewFromInt(1)
+	for charCode, value := range currencies {
+		fcs.currencies[charCode] = value
+	}
+	return fcs
+}
+
+func (fcs *FixedCurrencyStorage) GetAllCurrencies() []currency.Currency {
+	keys := make([]string, 0, len(fcs.currencies))
+	for k := range fcs.currencies {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]currency.Currency, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, currency.Currency{
+			CharCode: k,
+			Value:    fcs.currencies[k],
+		})
+	}
+	return result
+}
+
+func (fcs *FixedCurrencyStorage) GetCurrencyValue(curr string) (decimal.Decimal, error) {
+	value, inMap := fcs.currencies[curr]
+	if !inMap {
+		return value, currency.ErrCurrencyNotSupported
+	}
+	return value, nil
+}
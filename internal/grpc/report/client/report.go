@@ -7,14 +7,17 @@ import (
 
 	"github.com/cr00z/goSpendingBot/internal/grpc/report/api"
 	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 var connStr = "gospend-bot:5000"
 
-func SendReport(userID int64, period string, report *repository.Report) error {
+// SendReport отправляет боту рапорт, сформированный по запросу requestID
+func SendReport(ctx context.Context, requestID string, userID int64, period string, report *repository.Report) error {
 	conn, err := grpc.Dial(connStr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return errors.Wrap(err, "did not connect")
@@ -22,7 +25,7 @@ func SendReport(userID int64, period string, report *repository.Report) error {
 	defer conn.Close()
 	c := api.NewReportCollectorClient(conn)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(withTraceMetadata(ctx), time.Second)
 	defer cancel()
 
 	var repcat []*api.ReportBody_ReportByCategory
@@ -33,15 +36,30 @@ func SendReport(userID int64, period string, report *repository.Report) error {
 		})
 	}
 	body := api.ReportBody{
-		UserId:  userID,
-		Period:  period,
-		Repcat:  repcat,
-		MinDate: report.MinDate.Unix(),
+		UserId:    userID,
+		Period:    period,
+		Repcat:    repcat,
+		MinDate:   report.MinDate.Unix(),
+		RequestId: requestID,
 	}
 	r, err := c.ReceiveReport(ctx, &body)
 	if err != nil {
 		return errors.Wrap(err, "could not answer")
 	}
-	log.Printf("Answer: %s", r.GetAnswer())
+	log.Printf("Answer: %s, request_id: %s", r.GetAnswer(), requestID)
 	return nil
 }
+
+// Контекст трейса передается в метаданных, чтобы бот продолжил трейс
+func withTraceMetadata(ctx context.Context) context.Context {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ctx
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		log.Println("trace inject failed:", err)
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, metadata.New(carrier))
+}
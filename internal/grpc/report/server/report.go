@@ -9,26 +9,26 @@ import (
 	"github.com/cr00z/goSpendingBot/internal/grpc/report/api"
 	"github.com/cr00z/goSpendingBot/internal/model/messages"
 	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type ReportServer struct {
-	model    *messages.Model
-	tgClient *messages.MessageSender
+	model *messages.Model
 	api.UnimplementedReportCollectorServer
 }
 
-func NewServer(model *messages.Model, tgClient messages.MessageSender) error {
+func NewServer(model *messages.Model) error {
 	lis, err := net.Listen("tcp", ":5000")
 	if err != nil {
 		return errors.Wrap(err, "failed to listen")
 	}
 	s := grpc.NewServer()
 	api.RegisterReportCollectorServer(s, &ReportServer{
-		model:    model,
-		tgClient: &tgClient,
+		model: model,
 	})
 	if err := s.Serve(lis); err != nil {
 		return errors.Wrap(err, "failed to serve")
@@ -37,7 +37,11 @@ func NewServer(model *messages.Model, tgClient messages.MessageSender) error {
 }
 
 func (s *ReportServer) ReceiveReport(ctx context.Context, in *api.ReportBody) (*api.ReportAccept, error) {
-	log.Printf("received report for userid %v", in.UserId)
+	span := startReceiveSpan(ctx, in.RequestId)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	log.Printf("received report for userid %v, request_id: %s", in.UserId, in.RequestId)
 
 	var reportByCategory []*repository.ReportByCategory
 	for _, row := range in.Repcat {
@@ -52,11 +56,26 @@ func (s *ReportServer) ReceiveReport(ctx context.Context, in *api.ReportBody) (*
 		MinDate:          time.Unix(in.MinDate, 0),
 	}
 
-	message, err := s.model.ProceedCommandReport(ctx, in.UserId, report)
-	if err != nil {
-		return nil, err
-	}
-	err = (*s.tgClient).SendMessage(ctx, message, in.UserId)
+	err := s.model.DeliverReport(ctx, in.RequestId, in.UserId, in.Period, report)
 
 	return &api.ReportAccept{Answer: "ok"}, err
 }
+
+// Спан получения рапорта продолжает трейс из метаданных запроса
+func startReceiveSpan(ctx context.Context, requestID string) opentracing.Span {
+	var options []opentracing.StartSpanOption
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		carrier := opentracing.TextMapCarrier{}
+		for key, values := range md {
+			if len(values) > 0 {
+				carrier[key] = values[0]
+			}
+		}
+		if parent, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier); err == nil {
+			options = append(options, opentracing.ChildOf(parent))
+		}
+	}
+	span := opentracing.StartSpan("receive report", options...)
+	span.SetTag("request_id", requestID)
+	return span
+}
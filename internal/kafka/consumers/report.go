@@ -9,7 +9,9 @@ import (
 
 	"github.com/Shopify/sarama"
 	grpc_report "github.com/cr00z/goSpendingBot/internal/grpc/report/client"
+	producer "github.com/cr00z/goSpendingBot/internal/kafka/producers"
 	"github.com/cr00z/goSpendingBot/internal/report_service/model"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 )
 
@@ -81,16 +83,9 @@ func (consumer *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, clai
 			return errors.Wrap(err, "input message unmarshal error")
 		}
 
-		report, err := consumer.model.Store.ReportPeriod(consumer.ctx,
-			request.UserID, request.DateFirst, request.DateLast)
+		err = consumer.prepareReport(msg, request)
 		if err != nil {
-			return errors.Wrap(err, "service error")
-		}
-
-		err = grpc_report.SendReport(request.UserID, request.Period, report)
-		if err != nil {
-			log.Println(err.Error())
-			return errors.Wrap(err, "send to bot error")
+			return err
 		}
 
 		session.MarkMessage(msg, "")
@@ -98,3 +93,38 @@ func (consumer *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, clai
 
 	return nil
 }
+
+// Формирование рапорта и отправка боту вместе с идентификатором запроса
+func (consumer *Consumer) prepareReport(msg *sarama.ConsumerMessage, request ReportMessage) error {
+	carrier := opentracing.TextMapCarrier{}
+	for _, header := range msg.Headers {
+		carrier[string(header.Key)] = string(header.Value)
+	}
+	requestID := carrier[producer.RequestIDHeader]
+
+	// Трейс продолжает трейс запроса рапорта в боте, если контекст есть в заголовках
+	var options []opentracing.StartSpanOption
+	if parent, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier); err == nil {
+		options = append(options, opentracing.FollowsFrom(parent))
+	}
+	span := opentracing.StartSpan("prepare report", options...)
+	span.SetTag("request_id", requestID)
+	defer span.Finish()
+	ctx := opentracing.ContextWithSpan(consumer.ctx, span)
+
+	log.Printf("preparing report, request_id: %s, user_id: %d, period: %s",
+		requestID, request.UserID, request.Period)
+
+	report, err := consumer.model.Store.ReportPeriod(ctx,
+		request.UserID, request.DateFirst, request.DateLast)
+	if err != nil {
+		return errors.Wrap(err, "service error")
+	}
+
+	err = grpc_report.SendReport(ctx, requestID, request.UserID, request.Period, report)
+	if err != nil {
+		log.Println(err.Error())
+		return errors.Wrap(err, "send to bot error")
+	}
+	return nil
+}
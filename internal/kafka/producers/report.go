@@ -1,21 +1,26 @@
 package producer
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 )
 
-var (
-	RequestTimeout  = errors.New("report-requests request to consumer timeout")
-	ResponseTimeout = errors.New("report-requests response from consumer timeout")
-)
+// Заголовок сообщения с идентификатором запроса, сервис отчетов возвращает его
+// вместе с рапортом, чтобы бот сопоставил рапорт с запросом
+const RequestIDHeader = "request-id"
+
+// Сколько ждать подтверждения записи запроса рапорта от Kafka
+const sendTimeout = 5 * time.Second
 
 type ReportProducer interface {
-	SendMessage(userID int64, period string, dateFirst time.Time, dateLast time.Time) error
+	SendMessage(ctx context.Context, requestID string,
+		userID int64, period string, dateFirst time.Time, dateLast time.Time) error
 }
 
 type ProducerOptions struct {
@@ -23,31 +28,35 @@ type ProducerOptions struct {
 	BrokersList []string
 }
 
+// Producer отправляет запросы рапортов синхронно: каждый вызов SendMessage
+// получает подтверждение или ошибку записи именно своего сообщения
 type Producer struct {
 	options  ProducerOptions
-	producer sarama.AsyncProducer
+	producer sarama.SyncProducer
 }
 
 func New(options ProducerOptions) (*Producer, error) {
 	config := sarama.NewConfig()
 	config.Version = sarama.V2_5_0_0
 	config.Producer.Return.Successes = true
+	config.Producer.Timeout = sendTimeout
+	config.Net.DialTimeout = sendTimeout
+	config.Net.ReadTimeout = sendTimeout
+	config.Net.WriteTimeout = sendTimeout
 
-	producer, err := sarama.NewAsyncProducer(options.BrokersList, config)
+	producer, err := sarama.NewSyncProducer(options.BrokersList, config)
 	if err != nil {
 		return nil, errors.Wrap(err, "starting Sarama producer")
 	}
 
-	go func() {
-		for err := range producer.Errors() {
-			log.Println("Failed to write message:", err)
-		}
-	}()
+	return newProducer(options, producer), nil
+}
 
+func newProducer(options ProducerOptions, producer sarama.SyncProducer) *Producer {
 	return &Producer{
 		options:  options,
 		producer: producer,
-	}, nil
+	}
 }
 
 type ReportMessage struct {
@@ -57,30 +66,46 @@ type ReportMessage struct {
 	DateLast  time.Time `json:"date_last"`
 }
 
-func (p *Producer) SendMessage(userID int64, period string, dateFirst time.Time, dateLast time.Time) error {
+func (p *Producer) SendMessage(ctx context.Context, requestID string,
+	userID int64, period string, dateFirst time.Time, dateLast time.Time) error {
+
 	msg := ReportMessage{userID, period, dateFirst, dateLast}
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
 		log.Println(err.Error())
 	}
 	saramaMsg := &sarama.ProducerMessage{
-		Topic: p.options.KafkaTopic,
-		Value: sarama.ByteEncoder(msgBytes),
+		Topic:   p.options.KafkaTopic,
+		Value:   sarama.ByteEncoder(msgBytes),
+		Headers: messageHeaders(ctx, requestID),
 	}
 
 	log.Println(saramaMsg)
-	select {
-	case p.producer.Input() <- saramaMsg:
-	case <-time.After(5 * time.Second):
-		return RequestTimeout
-	}
-
-	select {
-	case successMsg := <-p.producer.Successes():
-		log.Println("Successful to write message, offset:", successMsg.Offset)
-	case <-time.After(5 * time.Second):
-		return ResponseTimeout
+	_, offset, err := p.producer.SendMessage(saramaMsg)
+	if err != nil {
+		return errors.Wrapf(err, "report request %s", requestID)
 	}
+	log.Printf("Successful to write message, request_id: %s, offset: %d", requestID, offset)
 
 	return nil
 }
+
+// Заголовки с идентификатором запроса и контекстом трейса,
+// чтобы сервис отчетов продолжил трейс запроса рапорта
+func messageHeaders(ctx context.Context, requestID string) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{{Key: []byte(RequestIDHeader), Value: []byte(requestID)}}
+
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return headers
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		log.Println("trace inject failed:", err)
+		return headers
+	}
+	for key, value := range carrier {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return headers
+}
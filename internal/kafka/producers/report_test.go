@@ -0,0 +1,45 @@
+package producer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// запрос рапорта уходит с заголовком идентификатора запроса
+func TestProducer_SendMessage_ShouldSendRequestIDHeader(t *testing.T) {
+	syncProducer := mocks.NewSyncProducer(t, nil)
+	syncProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "report-requests", msg.Topic)
+		for _, header := range msg.Headers {
+			if string(header.Key) == RequestIDHeader {
+				assert.Equal(t, "req-1", string(header.Value))
+				return nil
+			}
+		}
+		return errors.New("request id header is missing")
+	})
+	p := newProducer(ProducerOptions{KafkaTopic: "report-requests"}, syncProducer)
+
+	err := p.SendMessage(context.Background(), "req-1", 1, "W", time.Now().AddDate(0, 0, -7), time.Now())
+
+	assert.NoError(t, err)
+	assert.NoError(t, syncProducer.Close())
+}
+
+// ошибка записи возвращается вызвавшему SendMessage
+func TestProducer_SendMessage_WriteFailed_ShouldReturnError(t *testing.T) {
+	syncProducer := mocks.NewSyncProducer(t, nil)
+	syncProducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	p := newProducer(ProducerOptions{KafkaTopic: "report-requests"}, syncProducer)
+
+	err := p.SendMessage(context.Background(), "req-1", 1, "W", time.Now().AddDate(0, 0, -7), time.Now())
+
+	assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+	assert.NoError(t, syncProducer.Close())
+}
@@ -0,0 +1,124 @@
+// Package migrate применяет встроенные миграции goose к базе хранилища
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/fs"
+	"log"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pressly/goose/v3"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSqlite   = "sqlite3"
+)
+
+const (
+	CommandUp     = "up"
+	CommandDown   = "down"
+	CommandStatus = "status"
+)
+
+// Ключ advisory lock в postgres, общий для всех инстансов бота и сервиса отчетов
+const lockID int64 = 0x676f7370656e64
+
+var ErrUnknownCommand = errors.New("unknown migrate command")
+
+// goose хранит файловую систему, диалект и логгер в глобальных переменных
+var gooseMu sync.Mutex
+
+type Migrator struct {
+	db      *sql.DB
+	dialect string
+	fsys    fs.FS
+}
+
+func New(db *sql.DB, dialect string, fsys fs.FS) *Migrator {
+	return &Migrator{
+		db:      db,
+		dialect: dialect,
+		fsys:    fsys,
+	}
+}
+
+// Run выполняет команду up, down или status, вывод goose пишется в out
+func (m *Migrator) Run(ctx context.Context, command string, out io.Writer) error {
+	switch command {
+	case CommandUp:
+		return m.Up(ctx, out)
+	case CommandDown:
+		return m.Down(ctx, out)
+	case CommandStatus:
+		return m.Status(ctx, out)
+	}
+	return errors.Wrap(ErrUnknownCommand, command)
+}
+
+// Up применяет все непримененные миграции
+func (m *Migrator) Up(ctx context.Context, out io.Writer) error {
+	return m.run(ctx, out, func() error {
+		return goose.Up(m.db, ".")
+	})
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context, out io.Writer) error {
+	return m.run(ctx, out, func() error {
+		return goose.Down(m.db, ".")
+	})
+}
+
+// Status выводит список миграций с датой применения
+func (m *Migrator) Status(ctx context.Context, out io.Writer) error {
+	return m.run(ctx, out, func() error {
+		return goose.Status(m.db, ".")
+	})
+}
+
+func (m *Migrator) run(ctx context.Context, out io.Writer, migrate func() error) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return errors.Wrap(err, "migrations lock failed")
+	}
+	defer unlock()
+
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	goose.SetBaseFS(m.fsys)
+	goose.SetLogger(log.New(out, "", 0))
+	if err := goose.SetDialect(m.dialect); err != nil {
+		return err
+	}
+
+	return errors.Wrap(migrate(), "migrate failed")
+}
+
+// lock не дает нескольким инстансам мигрировать одну базу одновременно.
+// Остальные инстансы ждут снятия блокировки и видят уже примененные миграции.
+// sqlite работает с одним соединением, база блокируется транзакцией миграции
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if m.dialect != DialectPostgres {
+		return func() {}, nil
+	}
+
+	// Advisory lock принадлежит сессии, поэтому берется и снимается на одном соединении
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, lockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, lockID)
+		conn.Close()
+	}, nil
+}
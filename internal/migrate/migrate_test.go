@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cr00z/goSpendingBot/migrations"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSqlite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	row := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1;`, name)
+	require.NoError(t, row.Scan(&count))
+	return count > 0
+}
+
+func TestMigrator_Up_ShouldApplyOnce(t *testing.T) {
+	ctx := context.Background()
+	db := openSqlite(t)
+	m := New(db, DialectSqlite, migrations.Sqlite)
+
+	require.NoError(t, m.Up(ctx, &bytes.Buffer{}))
+	// Повторный запуск при старте ничего не меняет
+	var out bytes.Buffer
+	require.NoError(t, m.Up(ctx, &out))
+
+	assert.True(t, tableExists(t, db, "spendings"))
+	assert.Contains(t, out.String(), "no migrations to run")
+}
+
+func TestMigrator_Down_ShouldRollbackLast(t *testing.T) {
+	ctx := context.Background()
+	db := openSqlite(t)
+	m := New(db, DialectSqlite, migrations.Sqlite)
+	require.NoError(t, m.Up(ctx, &bytes.Buffer{}))
+
+	err := m.Down(ctx, &bytes.Buffer{})
+
+	require.NoError(t, err)
+	names, err := fs.Glob(migrations.Sqlite, "*.sql")
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, m.Status(ctx, &out))
+	assert.Equal(t, 1, strings.Count(out.String(), "Pending"))
+	assert.Regexp(t, `Pending\s+-- `+regexp.QuoteMeta(names[len(names)-1]), out.String())
+	assert.True(t, tableExists(t, db, "spendings"))
+}
+
+func TestMigrator_Run_Status(t *testing.T) {
+	ctx := context.Background()
+	db := openSqlite(t)
+	m := New(db, DialectSqlite, migrations.Sqlite)
+	var out bytes.Buffer
+
+	require.NoError(t, m.Run(ctx, CommandStatus, &out))
+	assert.Regexp(t, `Pending\s+-- 20221120120000_init_db.sql`, out.String())
+	assert.Regexp(t, `Pending\s+-- 20221202120000_create_audit_log.sql`, out.String())
+
+	out.Reset()
+	require.NoError(t, m.Run(ctx, CommandUp, &bytes.Buffer{}))
+	require.NoError(t, m.Run(ctx, CommandStatus, &out))
+	assert.NotContains(t, out.String(), "Pending")
+}
+
+func TestMigrator_Run_UnknownCommand(t *testing.T) {
+	m := New(openSqlite(t), DialectSqlite, migrations.Sqlite)
+
+	err := m.Run(context.Background(), "redo", &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+}
+
+func TestMigrations_Postgres_ShouldBeEmbedded(t *testing.T) {
+	names, err := fs.Glob(migrations.Postgres, "*.sql")
+	require.NoError(t, err)
+	assert.Contains(t, names, "20221013135954_init_db.sql")
+	assert.Contains(t, names, "20221018164631_create_index_spendings.sql")
+}
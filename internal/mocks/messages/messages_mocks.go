@@ -34,6 +34,34 @@ func (m *MockMessageSender) EXPECT() *MockMessageSenderMockRecorder {
 	return m.recorder
 }
 
+// EditMessage mocks base method.
+func (m *MockMessageSender) EditMessage(ctx context.Context, text string, userID int64, messageID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditMessage", ctx, text, userID, messageID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EditMessage indicates an expected call of EditMessage.
+func (mr *MockMessageSenderMockRecorder) EditMessage(ctx, text, userID, messageID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditMessage", reflect.TypeOf((*MockMessageSender)(nil).EditMessage), ctx, text, userID, messageID)
+}
+
+// SendDocument mocks base method.
+func (m *MockMessageSender) SendDocument(ctx context.Context, name string, data []byte, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDocument", ctx, name, data, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDocument indicates an expected call of SendDocument.
+func (mr *MockMessageSenderMockRecorder) SendDocument(ctx, name, data, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDocument", reflect.TypeOf((*MockMessageSender)(nil).SendDocument), ctx, name, data, userID)
+}
+
 // SendMessage mocks base method.
 func (m *MockMessageSender) SendMessage(ctx context.Context, text string, userID int64) error {
 	m.ctrl.T.Helper()
@@ -47,3 +75,18 @@ func (mr *MockMessageSenderMockRecorder) SendMessage(ctx, text, userID interface
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockMessageSender)(nil).SendMessage), ctx, text, userID)
 }
+
+// SendMessageWithID mocks base method.
+func (m *MockMessageSender) SendMessageWithID(ctx context.Context, text string, userID int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendMessageWithID", ctx, text, userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SendMessageWithID indicates an expected call of SendMessageWithID.
+func (mr *MockMessageSenderMockRecorder) SendMessageWithID(ctx, text, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessageWithID", reflect.TypeOf((*MockMessageSender)(nil).SendMessageWithID), ctx, text, userID)
+}
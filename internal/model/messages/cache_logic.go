@@ -3,35 +3,25 @@ package messages
 import (
 	"context"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cr00z/goSpendingBot/internal/cache"
 	"github.com/cr00z/goSpendingBot/internal/observability"
 	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/opentracing/opentracing-go"
 )
 
 // Запрос из кеша кода активной валюты
 func (s *Model) getActiveCurrencyFromCacheAndDB(ctx context.Context,
 	userID int64) (curr string, err error) {
 
-	key := strconv.FormatInt(userID, 10)
-	result, err := s.currCache.Get(key)
+	curr, err = s.currCache.Get(userID)
 	if err != nil {
 		curr, err = s.store.GetActiveCurrency(ctx, userID)
 		if err == nil {
-			eviction := s.currCache.Add(key, curr)
-			if eviction {
-				// Метрики: вытеснение из кэша
-				observability.CacheEvictionCountVec.WithLabelValues(s.currCache.Name()).Inc()
-			} else {
-				// Метрики: количество ключей - добавление ключа (без вытеснения)
-				observability.CacheKeyCountVec.WithLabelValues(s.currCache.Name()).Inc()
-			}
+			s.currCache.Add(userID, curr)
 		}
-	} else {
-		// Метрики: попадание в кэш
-		observability.CacheHitCountVec.WithLabelValues(s.currCache.Name()).Inc()
-		curr = result.(string)
 	}
 	return curr, err
 }
@@ -40,63 +30,152 @@ func (s *Model) getActiveCurrencyFromCacheAndDB(ctx context.Context,
 func (s *Model) getReportPeriodFromCacheAndDB(ctx context.Context,
 	msg Message, period string, dateFirst time.Time, dateLast time.Time) (report *repository.Report, err error) {
 
-	key := strconv.FormatInt(msg.UserID, 10) + "_" + period
-	result, err := s.reportCache.Get(key)
+	key := reportCacheKey(msg.UserID, period)
+	report, err = s.reportCache.Get(key)
 	if err == nil {
-		report = result.(*repository.Report)
-
 		// Инвалидация кэша при запросе рапорта
 		// минимальная дата рапорта из кэша еще влезает в запрошенный период?
 		if report.MinDate.Before(dateFirst) {
 			_ = s.reportCache.Delete(key)
-			err = cache.ErrElementNotInCache
-
-			// Метрики: количество ключей - удаление ключа
-			observability.CacheKeyCountVec.WithLabelValues(s.reportCache.Name()).Dec()
-
-		} else {
-			// Метрики: попадание в кэш
-			observability.CacheHitCountVec.WithLabelValues(s.reportCache.Name()).Inc()
+			report, err = nil, cache.ErrElementNotInCache
 		}
 	}
 	if err != nil {
-		// report, err = s.store.ReportPeriod(ctx, msg.UserID, dateFirst, dateLast)
-		// if err == nil {
-		// 	eviction := s.reportCache.Add(key, report)
-		// 	if eviction {
-		// 		// Метрики: вытеснение из кэша
-		// 		observability.CacheEvictionCountVec.WithLabelValues(s.reportCache.Name()).Inc()
-		// 	} else {
-		// 		// Метрики: количество ключей - добавление ключа (без вытеснения)
-		// 		observability.CacheKeyCountVec.WithLabelValues(s.reportCache.Name()).Inc()
-		// 	}
-		// }
-		err = s.reportService.SendMessage(msg.UserID, period, dateFirst, dateLast)
+		// Рапорт формирует сервис отчетов, в кэш его кладет CacheReport.
+		// Пока рапорт формируется, повторные запросы не отправляются
+		requestID, started := s.reports.start(key, msg.UserID, time.Now())
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag("request_id", requestID)
+		}
+		if !started {
+			// Метрики: запрос объединен с уже формирующимся
+			observability.ReportCoalescedCountVec.WithLabelValues(period).Inc()
+			return nil, errReportPending
+		}
+		err = s.requestReport(ctx, key, requestID, msg.UserID, period, dateFirst, dateLast)
+		if err != nil {
+			s.reports.done(key, requestID)
+		}
 	}
 	return report, err
 }
 
+// Запрос рапорта у сервиса отчетов. Сообщение "Preparing report…" отправляется
+// до запроса, чтобы его id был известен, когда рапорт придет
+func (s *Model) requestReport(ctx context.Context, key string, requestID string,
+	userID int64, period string, dateFirst time.Time, dateLast time.Time) error {
+
+	messageID, err := s.tgClient.SendMessageWithID(ctx, reportPreparingStr, userID)
+	if err != nil {
+		return err
+	}
+	s.reports.setMessageID(key, requestID, messageID)
+
+	return s.reportService.SendMessage(ctx, requestID, userID, period, dateFirst, dateLast)
+}
+
+// DeliverReport сохраняет рапорт, полученный от сервиса отчетов в ответ на запрос
+// requestID, и заменяет им сообщение "Preparing report…". Если заменить сообщение
+// не удалось или запрос неизвестен, рапорт отправляется новым сообщением
+func (s *Model) DeliverReport(ctx context.Context, requestID string,
+	userID int64, period string, report *repository.Report) error {
+
+	pending, matched := s.cacheReport(userID, period, requestID, report)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag("matched", matched)
+	}
+
+	message, err := s.ProceedCommandReport(ctx, userID, report)
+	if pending.messageID != 0 {
+		editErr := s.tgClient.EditMessage(ctx, message, userID, pending.messageID)
+		if editErr == nil {
+			return err
+		}
+		// Метрики: сообщение не заменено, рапорт отправляется отдельно
+		observability.ReportEditFailedCount.Inc()
+	}
+	if sendErr := s.tgClient.SendMessage(ctx, message, userID); err == nil {
+		err = sendErr
+	}
+	return err
+}
+
+// Сохранение рапорта в кэш, чтобы повторные запросы за тот же период
+// отдавались из кэша. false - рапорт не ответ на последний запрос этого рапорта.
+// Такой рапорт, как и рапорт, после запроса которого кэш юзера инвалидировался,
+// мог устареть и в кэш не попадает
+func (s *Model) cacheReport(userID int64, period string, requestID string,
+	report *repository.Report) (pendingReport, bool) {
+
+	key := reportCacheKey(userID, period)
+	pending, ok := s.reports.complete(key, requestID, func() {
+		s.reportCache.Add(key, report)
+	})
+	if !ok {
+		// Метрики: ответ на неизвестный или устаревший запрос
+		observability.ReportUnmatchedCountVec.WithLabelValues(period).Inc()
+		return pendingReport{}, false
+	}
+	// Метрики: время от запроса рапорта до получения ответа
+	observability.HistogramReportRoundTripTimeVec.WithLabelValues(period).
+		Observe(time.Since(pending.started).Seconds())
+	return pending, true
+}
+
+// Ключ рапорта юзера за период W, M или Y в кэше рапортов
+func reportCacheKey(userID int64, period string) string {
+	return strconv.FormatInt(userID, 10) + "_" + period
+}
+
 // Инвалидация кэша при добавлении траты
 // Если дата траты > (now()-год) -> протухает годовой
 // Если дата траты > (now()-месяц) -> протухает месячный рапорт
 // Если дата траты > (now()-неделя) -> протухает недельный рапорт
-// Метрики: вытеснение из кэша
 func (s *Model) invalidateReportPeriodInCache(userID int64, dateFirst time.Time) {
-	key := strconv.FormatInt(userID, 10)
+	// Рапорты, которые уже формируются, не попадут в кэш.
+	// Счетчик увеличивается до удаления из кэша: рапорт, записанный раньше, удалится
+	s.reports.invalidate(userID)
+
 	dateLast := time.Now()
 
 	if dateFirst.After(dateLast.AddDate(-1, 0, 0)) {
-		_ = s.reportCache.Delete(key + "_Y")
-		observability.CacheEvictionCountVec.WithLabelValues(s.reportCache.Name()).Inc()
+		_ = s.reportCache.Delete(reportCacheKey(userID, "Y"))
 	}
 
 	if dateFirst.After(dateLast.AddDate(0, -1, 0)) {
-		_ = s.reportCache.Delete(key + "_M")
-		observability.CacheEvictionCountVec.WithLabelValues(s.reportCache.Name()).Inc()
+		_ = s.reportCache.Delete(reportCacheKey(userID, "M"))
 	}
 
 	if dateFirst.After(dateLast.AddDate(0, 0, -7)) {
-		_ = s.reportCache.Delete(key + "_W")
-		observability.CacheEvictionCountVec.WithLabelValues(s.reportCache.Name()).Inc()
+		_ = s.reportCache.Delete(reportCacheKey(userID, "W"))
+	}
+}
+
+// ReportCacheInvalidated вызывается, когда другая реплика изменила или удалила
+// рапорт key в общем кэше. Рапорты юзера, которые формируются в этой реплике,
+// могли устареть и не должны перезаписать кэш
+func (s *Model) ReportCacheInvalidated(key string) {
+	user, _, _ := strings.Cut(key, "_")
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return
 	}
+	s.reports.invalidate(userID)
+}
+
+// Инвалидация всех рапортов юзера, когда дата изменившихся трат неизвестна
+func (s *Model) invalidateAllReportsInCache(userID int64) {
+	s.invalidateReportPeriodInCache(userID, time.Now())
+}
+
+// Инвалидация кэша активной валюты юзера
+func (s *Model) invalidateCurrencyInCache(userID int64) {
+	_ = s.currCache.Delete(userID)
+}
+
+// Удаление из кэшей всех данных юзера вместе с его запросами рапортов
+func (s *Model) invalidateUserInCache(userID int64) {
+	s.reports.forgetUser(userID)
+	s.invalidateCurrencyInCache(userID)
+	s.invalidateAllReportsInCache(userID)
 }
@@ -3,10 +3,10 @@ package messages
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cr00z/goSpendingBot/internal/backup"
 	"github.com/cr00z/goSpendingBot/internal/cache"
 	"github.com/cr00z/goSpendingBot/internal/currency"
 	producer "github.com/cr00z/goSpendingBot/internal/kafka/producers"
@@ -18,25 +18,34 @@ import (
 )
 
 var (
-	serviceErrorStr  = "Service error, try again later"
-	currencyErrorStr = "Currency service error, try again later"
+	serviceErrorStr    = "Service error, try again later"
+	currencyErrorStr   = "Currency service error, try again later"
+	reportPreparingStr = "Preparing report…"
 )
 
+var errReportPending = errors.New("report is already being prepared")
+
 type MessageSender interface {
 	SendMessage(ctx context.Context, text string, userID int64) error
+	// SendMessageWithID отправляет сообщение и возвращает его id для EditMessage
+	SendMessageWithID(ctx context.Context, text string, userID int64) (int, error)
+	// EditMessage заменяет текст отправленного ранее сообщения
+	EditMessage(ctx context.Context, text string, userID int64, messageID int) error
+	SendDocument(ctx context.Context, name string, data []byte, userID int64) error
 }
 
 type Model struct {
 	tgClient      MessageSender
 	store         repository.Storager
-	currCache     cache.Storager
-	reportCache   cache.Storager
+	currCache     cache.Cache[int64, string]
+	reportCache   cache.Cache[string, *repository.Report]
 	currencies    currency.CurrencyStorager
 	reportService producer.ReportProducer
+	reports       *pendingReports
 }
 
-func New(tgClient MessageSender, store repository.Storager, currCache cache.Storager,
-	reportCache cache.Storager, currencies currency.CurrencyStorager, reportService producer.ReportProducer) *Model {
+func New(tgClient MessageSender, store repository.Storager, currCache cache.Cache[int64, string],
+	reportCache cache.Cache[string, *repository.Report], currencies currency.CurrencyStorager, reportService producer.ReportProducer) *Model {
 	return &Model{
 		tgClient:      tgClient,
 		store:         store,
@@ -44,12 +53,15 @@ func New(tgClient MessageSender, store repository.Storager, currCache cache.Stor
 		reportCache:   reportCache,
 		currencies:    currencies,
 		reportService: reportService,
+		reports:       newPendingReports(reportPendingWindow),
 	}
 }
 
 type Message struct {
 	Text   string
 	UserID int64
+	// Содержимое присланного файла, Text тогда содержит подпись к нему
+	Document []byte
 }
 
 const (
@@ -65,11 +77,21 @@ const (
 	commandCurrencySet      = "/curset"
 	commandLimitGet         = "/limitget"
 	commandLimitSet         = "/limitset"
+	commandHistory          = "/history"
+	commandUndo             = "/undo"
+	commandBackup           = "/backup"
+	commandRestore          = "/restore"
+	commandForgetMe         = "/forgetme"
+
+	// Псевдокоманда для трат, введенных обычным текстом без команды
+	commandTextSpending = "/textexp"
 
 	messageHello = "Hello! I can help you manage your spendings."
 	messageHelp  = "You can control me by sending these commands:\n\n" +
 		"*Expenses*\n" +
-		commandCreateSpending + ` <category name> <amount> \[dd/mm/yy]  - add new expense` + "\n\n" +
+		commandCreateSpending + ` <category name> <amount> \[dd/mm/yy]  - add new expense` + "\n" +
+		"<category name> <amount> \\[date] - add new expense without a command, " +
+		"date may be dd/mm/yy, yesterday, вчера, позавчера or a weekday\n\n" +
 		"*Edit Categories*\n" +
 		commandCreateCategory + " <category name> - create a new expense category\n" +
 		commandGetAllCategories + " - get a list of your expense categories\n\n" +
@@ -84,7 +106,15 @@ const (
 		"*Limits*\n" +
 		commandLimitGet + " - get month expense limit\n" +
 		commandLimitSet + ` \[amount] - set month expense limit. If the value is` +
-		` not set, then there will be no limit.`
+		` not set, then there will be no limit.` + "\n\n" +
+		"*History*\n" +
+		commandHistory + " - get recent changes of your data\n" +
+		commandUndo + " - undo your last change made within a day\n\n" +
+		"*Backup*\n" +
+		commandBackup + " - get a file with all your data\n" +
+		commandRestore + " - send the backup file with this caption to restore your data\n\n" +
+		"*Privacy*\n" +
+		commandForgetMe + " - delete all your data"
 )
 
 func (s *Model) proceedCommand(ctx context.Context,
@@ -104,6 +134,9 @@ func (s *Model) proceedCommand(ctx context.Context,
 	case commandCreateSpending:
 		message, err = s.handleCommandCreateSpending(ctx, msg)
 
+	case commandTextSpending:
+		message, err = s.handleTextCreateSpending(ctx, msg)
+
 	case commandCreateCategory:
 		message, err = s.handleCommandCreateCategory(ctx, msg)
 
@@ -140,6 +173,21 @@ func (s *Model) proceedCommand(ctx context.Context,
 	case commandLimitSet:
 		message, err = s.handleCommandLimitSet(ctx, msg)
 
+	case commandHistory:
+		message, err = s.handleCommandHistory(ctx, msg)
+
+	case commandUndo:
+		message, err = s.handleCommandUndo(ctx, msg)
+
+	case commandBackup:
+		message, err = s.handleCommandBackup(ctx, msg)
+
+	case commandRestore:
+		message, err = s.handleCommandRestore(ctx, msg)
+
+	case commandForgetMe:
+		message, err = s.handleCommandForgetMe(ctx, msg)
+
 	default:
 		message = "Я не знаю эту команду"
 	}
@@ -165,8 +213,16 @@ func (s *Model) IncomingMessage(ctx context.Context, msg Message) error {
 		command != commandCurrencyActive &&
 		command != commandCurrencySet &&
 		command != commandLimitGet &&
-		command != commandLimitSet {
+		command != commandLimitSet &&
+		command != commandHistory &&
+		command != commandUndo &&
+		command != commandBackup &&
+		command != commandRestore &&
+		command != commandForgetMe {
 		command = "/unknown"
+		if isTextSpending(msg.Text) {
+			command = commandTextSpending
+		}
 	}
 
 	// Метрика на количество запросов, можно заменить на histogram_count
@@ -224,9 +280,38 @@ func (s *Model) handleCommandCreateSpending(ctx context.Context, msg Message) (s
 		return "Unknown category", repository.ErrCategoryIsEmpty
 	}
 
+	return s.createSpending(ctx, msg.UserID, categoryName, amount, date)
+}
+
+// Обработчик траты, введенной обычным текстом: "coffee 250", "taxi 700 yesterday"
+func (s *Model) handleTextCreateSpending(ctx context.Context, msg Message) (string, error) {
+	spending, err := parseTextSpending(msg.Text, time.Now())
+	if err != nil {
+		return "Unknown expense, use: <category name> <amount> [date]", nil
+	}
+
+	// Любой текст с числом похож на трату, поэтому категории без команды
+	// не создаются: трата принимается только в существующую категорию
+	categories, err := s.store.GetAllCategories(ctx, msg.UserID)
+	if err != nil {
+		return serviceErrorStr, err
+	}
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, spending.CategoryName) {
+			return s.createSpending(ctx, msg.UserID, category.Name, spending.Amount, spending.Date)
+		}
+	}
+	return fmt.Sprintf("Unknown category '%s', create it with /newcat %s or use /addexp",
+		spending.CategoryName, spending.CategoryName), nil
+}
+
+// Сохранение траты в активной валюте пользователя
+func (s *Model) createSpending(ctx context.Context,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) (string, error) {
+
 	// Конвертация в валюту
 
-	curr, err := s.getActiveCurrencyFromCacheAndDB(ctx, msg.UserID)
+	curr, err := s.getActiveCurrencyFromCacheAndDB(ctx, userID)
 	if err != nil {
 		return serviceErrorStr, err
 	}
@@ -238,15 +323,15 @@ func (s *Model) handleCommandCreateSpending(ctx context.Context, msg Message) (s
 
 	// Проверка лимита
 
-	err = s.store.CreateSpending(ctx, msg.UserID, categoryName, amount, date)
+	err = s.store.CreateSpending(ctx, userID, categoryName, amount, date)
 	if err != nil {
-		if err == repository.ErrLimitExceeded {
+		if errors.Is(err, repository.ErrLimitExceeded) {
 			return "Limit exceeded", nil
 		}
 		return serviceErrorStr, err
 	}
 
-	s.invalidateReportPeriodInCache(msg.UserID, date)
+	s.invalidateReportPeriodInCache(userID, date)
 
 	return "Exspense added", nil
 }
@@ -329,11 +414,15 @@ func (s *Model) handleCommandReport(ctx context.Context,
 	msg Message, period string, dateFirst time.Time, dateLast time.Time) (string, error) {
 
 	report, err := s.getReportPeriodFromCacheAndDB(ctx, msg, period, dateFirst, dateLast)
+	if errors.Is(err, errReportPending) {
+		return "Report is already being prepared", nil
+	}
 	if err != nil {
 		return serviceErrorStr, err
 	}
 	if report == nil {
-		return "Report proceeed", nil
+		// Ответом будет сообщение "Preparing report…", его заменит рапорт
+		return "", nil
 	}
 
 	return s.ProceedCommandReport(ctx, msg.UserID, report)
@@ -400,7 +489,7 @@ func (s *Model) handleCommandCurrencySet(ctx context.Context, msg Message) (stri
 		return serviceErrorStr, err
 	}
 
-	s.currCache.Add(strconv.FormatInt(msg.UserID, 10), currCharCode)
+	s.currCache.Add(msg.UserID, currCharCode)
 
 	return s.handleCommandCurrencyActive(ctx, msg)
 }
@@ -411,7 +500,7 @@ func (s *Model) handleCommandLimitGet(ctx context.Context, msg Message) (string,
 	var body string
 	limit, err := s.store.GetLimit(ctx, msg.UserID)
 	if err != nil {
-		if err == repository.ErrLimitNotSet {
+		if errors.Is(err, repository.ErrLimitNotSet) {
 			body = "not set"
 		} else {
 			return serviceErrorStr, err
@@ -463,3 +552,148 @@ func (s *Model) handleCommandLimitSet(ctx context.Context, msg Message) (string,
 
 	return s.handleCommandLimitGet(ctx, msg)
 }
+
+// Количество записей журнала изменений в ответе на /history
+const historySize = 10
+
+// Обработчик команды просмотра последних изменений
+func (s *Model) handleCommandHistory(ctx context.Context, msg Message) (string, error) {
+	history, err := s.store.GetHistory(ctx, msg.UserID, historySize)
+	if err != nil {
+		return serviceErrorStr, err
+	}
+
+	header := "*History (amounts in RUB):*"
+	body := " empty"
+	if len(history) > 0 {
+		changes := make([]string, 0, len(history))
+		for _, record := range history {
+			changes = append(changes, record.CreatedAt.Format("02/01/06 15:04")+" "+describeChange(record))
+		}
+		body = "\n" + strings.Join(changes, "\n")
+	}
+
+	return header + body, nil
+}
+
+// Отменить можно только изменения, сделанные не раньше undoWindow назад
+const undoWindow = 24 * time.Hour
+
+// Обработчик команды отмены последнего изменения
+func (s *Model) handleCommandUndo(ctx context.Context, msg Message) (string, error) {
+	record, err := s.store.Undo(ctx, msg.UserID, undoWindow)
+	if err != nil {
+		if errors.Is(err, repository.ErrNothingToUndo) {
+			return "Nothing to undo", nil
+		}
+		return serviceErrorStr, err
+	}
+
+	switch record.Entity {
+	case repository.AuditCurrency:
+		s.invalidateCurrencyInCache(msg.UserID)
+	case repository.AuditSpending:
+		// Дата отмененной траты не хранится в журнале отдельно
+		s.invalidateAllReportsInCache(msg.UserID)
+	}
+
+	return "*Undone:* " + describeChange(record), nil
+}
+
+// Обработчик команды резервного копирования, копия отправляется файлом
+func (s *Model) handleCommandBackup(ctx context.Context, msg Message) (string, error) {
+	data, err := s.store.ExportUserData(ctx, msg.UserID)
+	if err != nil {
+		return serviceErrorStr, err
+	}
+
+	now := time.Now()
+	document, err := backup.Marshal(data, now)
+	if err != nil {
+		return serviceErrorStr, err
+	}
+
+	name := "backup_" + now.Format("2006-01-02") + ".json"
+	if err = s.tgClient.SendDocument(ctx, name, document, msg.UserID); err != nil {
+		return serviceErrorStr, err
+	}
+
+	return fmt.Sprintf("*Backup:* %d categories, %d expenses. "+
+		"Send this file with the %s caption to restore your data",
+		len(data.Categories), len(data.Spendings), commandRestore), nil
+}
+
+// IsRestoreCommand проверяет, что подпись к файлу - команда восстановления.
+// Файлы с другой подписью не скачиваются
+func IsRestoreCommand(caption string) bool {
+	return strings.Split(caption, " ")[0] == commandRestore
+}
+
+// Обработчик команды восстановления из резервной копии.
+// Уже имеющиеся данные не дублируются, поэтому копию можно загружать повторно
+func (s *Model) handleCommandRestore(ctx context.Context, msg Message) (string, error) {
+	if msg.Document == nil {
+		return "Send the backup file with the " + commandRestore + " caption", nil
+	}
+
+	data, err := backup.Unmarshal(msg.Document)
+	if err != nil {
+		if errors.Is(err, backup.ErrUnsupportedVersion) {
+			return "Backup file is made by a newer version of the bot", err
+		}
+		return "Invalid backup file", err
+	}
+
+	if data.Currency != "" {
+		data.Currency = strings.ToUpper(data.Currency)
+		if _, err = s.currencies.GetCurrencyValue(data.Currency); err != nil {
+			return "Backup file has unknown currency " + data.Currency, err
+		}
+	}
+
+	result, err := s.store.ImportUserData(ctx, msg.UserID, data)
+	if err != nil {
+		return serviceErrorStr, err
+	}
+
+	s.invalidateUserInCache(msg.UserID)
+
+	return fmt.Sprintf("*Restored:* %d categories, %d expenses",
+		result.Categories, result.Spendings), nil
+}
+
+// Подтверждение удаления всех данных: /forgetme confirm
+const forgetMeConfirmation = "confirm"
+
+// Обработчик команды удаления всех данных юзера. Без подтверждения
+// только предупреждает, что удаление необратимо
+func (s *Model) handleCommandForgetMe(ctx context.Context, msg Message) (string, error) {
+	elements := strings.Fields(msg.Text)
+	if len(elements) != 2 || elements[1] != forgetMeConfirmation {
+		return "This will permanently delete all your expenses, categories, limit, currency " +
+			"and change history. Use " + commandBackup + " first if you want to keep a copy.\n" +
+			"Send `" + commandForgetMe + " " + forgetMeConfirmation + "` to proceed", nil
+	}
+
+	if err := s.store.DeleteUserData(ctx, msg.UserID); err != nil {
+		return serviceErrorStr, err
+	}
+	s.invalidateUserInCache(msg.UserID)
+
+	return "All your data has been deleted", nil
+}
+
+func describeChange(record *repository.AuditRecord) string {
+	entity := record.Entity
+	if entity == repository.AuditSpending {
+		entity = "expense"
+	}
+
+	switch record.Action {
+	case repository.AuditCreate:
+		return entity + " added: " + record.NewValue
+	case repository.AuditDelete:
+		return entity + " removed: " + record.OldValue
+	}
+	return entity + " changed: " + record.OldValue + " -> " + record.NewValue
+}
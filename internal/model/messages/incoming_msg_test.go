@@ -2,12 +2,28 @@ package messages
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cr00z/goSpendingBot/internal/cache"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_lru"
+	"github.com/cr00z/goSpendingBot/internal/cache/cache_redis"
+	"github.com/cr00z/goSpendingBot/internal/currency/fixedcurrency"
+	producer "github.com/cr00z/goSpendingBot/internal/kafka/producers"
 	mocks "github.com/cr00z/goSpendingBot/internal/mocks/messages"
+	"github.com/cr00z/goSpendingBot/internal/observability"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/memory"
 	"github.com/golang/mock/gomock"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_OnStartCommand_ShouldAnswerWithIntroMessage(t *testing.T) {
@@ -47,3 +63,407 @@ func Test_OnUnknownCommand_ShouldAnswerWithHelpMessage(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func Test_OnTextSpending_UnknownCategory_ShouldNotCreateCategory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	require.NoError(t, store.CreateCategory(context.TODO(), 123, "Taxi"))
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessage(gomock.Any(),
+			"Unknown category 'coffee', create it with /newcat coffee or use /addexp", int64(123)),
+		sender.EXPECT().SendMessage(gomock.Any(), "Exspense added", int64(123)),
+	)
+
+	model := newTestModel(sender, store, &countingReportProducer{})
+	err := model.IncomingMessage(context.TODO(), Message{Text: "coffee 250", UserID: 123})
+	require.NoError(t, err)
+	err = model.IncomingMessage(context.TODO(), Message{Text: "taxi 700 yesterday", UserID: 123})
+	require.NoError(t, err)
+
+	categories, err := store.GetAllCategories(context.TODO(), 123)
+	require.NoError(t, err)
+	if assert.Len(t, categories, 1) {
+		assert.Equal(t, "Taxi", categories[0].Name)
+	}
+	report, err := store.ReportPeriod(context.TODO(), 123, time.Now().AddDate(0, 0, -7), time.Now())
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assert.Equal(t, "Taxi", report.ReportByCategory[0].CategoryName)
+	}
+}
+
+func Test_OnUndoCommand_ShouldRevertAndInvalidateCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	currCache := cache_lru.NewLRUCache[int64, string]("currency", 10)
+	reportCache := cache_lru.NewLRUCache[string, *repository.Report]("report", 10)
+	require.NoError(t, store.SetActiveCurrency(context.TODO(), 123, "USD"))
+	currCache.Add(123, "USD")
+	reportCache.Add("123_W", &repository.Report{})
+
+	sender.EXPECT().SendMessage(gomock.Any(), "*Undone:* currency changed: RUB -> USD", int64(123))
+	sender.EXPECT().SendMessage(gomock.Any(), "Nothing to undo", int64(123))
+
+	model := New(sender, store, currCache, reportCache, nil, nil)
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/undo", UserID: 123})
+	require.NoError(t, err)
+	err = model.IncomingMessage(context.TODO(), Message{Text: "/undo", UserID: 123})
+	require.NoError(t, err)
+
+	_, err = currCache.Get(123)
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	curr, err := store.GetActiveCurrency(context.TODO(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, "RUB", curr)
+	// Отмена смены валюты не трогает кэш рапортов
+	_, err = reportCache.Get("123_W")
+	assert.NoError(t, err)
+}
+
+func Test_OnForgetMeCommand_ShouldDeleteOnlyAfterConfirmation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	currCache := cache_lru.NewLRUCache[int64, string]("currency", 10)
+	reportCache := cache_lru.NewLRUCache[string, *repository.Report]("report", 10)
+	require.NoError(t, store.CreateCategory(context.TODO(), 123, "food"))
+	currCache.Add(123, "USD")
+	reportCache.Add("123_M", &repository.Report{})
+	reportCache.Add("124_M", &repository.Report{})
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessage(gomock.Any(), gomock.Not("All your data has been deleted"), int64(123)),
+		sender.EXPECT().SendMessage(gomock.Any(), "All your data has been deleted", int64(123)),
+	)
+
+	model := New(sender, store, currCache, reportCache, nil, nil)
+	model.reports.start("123_W", 123, time.Now())
+	model.reports.start("124_W", 124, time.Now())
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/forgetme", UserID: 123})
+	require.NoError(t, err)
+	categories, err := store.GetAllCategories(context.TODO(), 123)
+	require.NoError(t, err)
+	assert.Len(t, categories, 1)
+
+	err = model.IncomingMessage(context.TODO(), Message{Text: "/forgetme confirm", UserID: 123})
+	require.NoError(t, err)
+
+	categories, err = store.GetAllCategories(context.TODO(), 123)
+	require.NoError(t, err)
+	assert.Empty(t, categories)
+	_, err = currCache.Get(123)
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	_, err = reportCache.Get("123_M")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+	_, err = reportCache.Get("124_M")
+	assert.NoError(t, err)
+	// Запросы рапортов юзера забыты вместе с кэшем
+	_, ok := model.reports.done("123_W", "")
+	assert.False(t, ok)
+	_, ok = model.reports.done("124_W", "")
+	assert.True(t, ok)
+}
+
+// восстановление сообщает, сколько данных добавлено, и не загружает копию с неизвестной валютой
+func Test_OnRestoreCommand_ShouldReportImportedAndRejectUnknownCurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	document := func(currency string) []byte {
+		return []byte(`{"version": 1, "currency": "` + currency + `", "categories": ["food"],
+			"spendings": [{"category": "food", "amount": "100", "date": "2022-11-20T12:00:00Z"}]}`)
+	}
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessage(gomock.Any(), "Backup file has unknown currency XYZ", int64(123)),
+		sender.EXPECT().SendMessage(gomock.Any(), "*Restored:* 1 categories, 1 expenses", int64(123)),
+		sender.EXPECT().SendMessage(gomock.Any(), "*Restored:* 0 categories, 0 expenses", int64(123)),
+	)
+
+	model := newTestModel(sender, store, nil)
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/restore", UserID: 123, Document: document("xyz")})
+	require.NoError(t, err)
+	categories, err := store.GetAllCategories(context.TODO(), 123)
+	require.NoError(t, err)
+	assert.Empty(t, categories)
+
+	for i := 0; i < 2; i++ {
+		err = model.IncomingMessage(context.TODO(), Message{Text: "/restore", UserID: 123, Document: document("rub")})
+		require.NoError(t, err)
+	}
+	curr, err := store.GetActiveCurrency(context.TODO(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, "RUB", curr)
+}
+
+func Test_OnReportCommand_ShouldServeCachedReportUntilStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	now := time.Now()
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessage(gomock.Any(), "*Report:*\nfood: 100.00 RUB", int64(123)),
+		sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(1, nil),
+	)
+
+	model := newTestModel(sender, store, reports)
+	model.reportCache.Add("123_W", &repository.Report{
+		ReportByCategory: []*repository.ReportByCategory{{CategoryName: "food", Sum: decimal.NewFromInt(100)}},
+		MinDate:          now,
+	})
+	// Рапорт содержит траты, которые уже не входят в месяц
+	model.reportCache.Add("123_M", &repository.Report{MinDate: now.AddDate(0, -2, 0)})
+
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+	require.NoError(t, err)
+	assert.Empty(t, reports.periods)
+
+	err = model.IncomingMessage(context.TODO(), Message{Text: "/repm", UserID: 123})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"M"}, reports.periods)
+}
+
+func Test_OnReportCommand_ShouldCoalesceRequestsUntilReportArrives(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	coalesced := observability.ReportCoalescedCountVec.WithLabelValues("M")
+	coalescedBefore := testutil.ToFloat64(coalesced)
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(7, nil),
+		sender.EXPECT().SendMessage(gomock.Any(), "Report is already being prepared", int64(123)).Times(2),
+		sender.EXPECT().EditMessage(gomock.Any(), "*Report:* empty", int64(123), 7),
+		sender.EXPECT().SendMessage(gomock.Any(), "*Report:* empty", int64(123)),
+	)
+
+	model := newTestModel(sender, store, reports)
+	for i := 0; i < 3; i++ {
+		err := model.IncomingMessage(context.TODO(), Message{Text: "/repm", UserID: 123})
+		require.NoError(t, err)
+	}
+	err := model.DeliverReport(context.TODO(), reports.requestIDs[0], 123, "M", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+	err = model.IncomingMessage(context.TODO(), Message{Text: "/repm", UserID: 123})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"M"}, reports.periods)
+	assert.Equal(t, 2., testutil.ToFloat64(coalesced)-coalescedBefore)
+}
+
+func Test_DeliverReport_ShouldEditPlaceholderOfLatestRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	unmatched := observability.ReportUnmatchedCountVec.WithLabelValues("W")
+	unmatchedBefore := testutil.ToFloat64(unmatched)
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(1, nil),
+		sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(2, nil),
+		// Опоздавший ответ на первый запрос приходит новым сообщением
+		sender.EXPECT().SendMessage(gomock.Any(), "*Report:* empty", int64(123)),
+		sender.EXPECT().EditMessage(gomock.Any(), "*Report:* empty", int64(123), 2),
+	)
+
+	model := newTestModel(sender, store, reports)
+	// Ответ на первый запрос не пришел вовремя, второй запрос отправляется заново
+	model.reports = newPendingReports(0)
+	for i := 0; i < 2; i++ {
+		err := model.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+		require.NoError(t, err)
+	}
+	require.Len(t, reports.requestIDs, 2)
+
+	err := model.DeliverReport(context.TODO(), reports.requestIDs[0], 123, "W", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+	err = model.DeliverReport(context.TODO(), reports.requestIDs[1], 123, "W", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, reports.requestIDs[0], reports.requestIDs[1])
+	assert.Equal(t, 1., testutil.ToFloat64(unmatched)-unmatchedBefore)
+}
+
+// опоздавший рапорт и рапорт, после запроса которого добавилась трата, не кэшируются
+func Test_DeliverReport_StaleReport_ShouldNotBeCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	require.NoError(t, store.CreateCategory(context.TODO(), 123, "food"))
+
+	sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(1, nil).Times(2)
+	sender.EXPECT().SendMessage(gomock.Any(), gomock.Any(), int64(123)).AnyTimes()
+	sender.EXPECT().EditMessage(gomock.Any(), "*Report:* empty", int64(123), 1)
+
+	model := newTestModel(sender, store, reports)
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+	require.NoError(t, err)
+	err = model.IncomingMessage(context.TODO(), Message{Text: "food 100", UserID: 123})
+	require.NoError(t, err)
+	err = model.DeliverReport(context.TODO(), reports.requestIDs[0], 123, "W", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+	_, err = model.reportCache.Get("123_W")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+
+	err = model.DeliverReport(context.TODO(), "unknown", 123, "M", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+	_, err = model.reportCache.Get("123_M")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+
+	// Следующий запрос уходит в сервис отчетов, а не берется из кэша
+	err = model.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"W", "W"}, reports.periods)
+}
+
+// рапорт, запрошенный в одной реплике, не кэшируется, если другая реплика
+// добавила трату и удалила рапорт из общего кэша
+func Test_DeliverReport_InvalidatedByOtherReplica_ShouldNotBeCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	server := miniredis.RunT(t)
+	require.NoError(t, store.CreateCategory(context.TODO(), 123, "food"))
+
+	sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(1, nil)
+	sender.EXPECT().SendMessage(gomock.Any(), gomock.Any(), int64(123)).AnyTimes()
+	sender.EXPECT().EditMessage(gomock.Any(), "*Report:* empty", int64(123), 1)
+
+	first := newRedisTestModel(t, server, sender, store, reports)
+	second := newRedisTestModel(t, server, sender, store, reports)
+	require.Eventually(t, func() bool {
+		return server.PubSubNumSub("gospend:invalidate:report")["gospend:invalidate:report"] == 2
+	}, time.Second, time.Millisecond)
+
+	err := first.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+	require.NoError(t, err)
+	err = second.IncomingMessage(context.TODO(), Message{Text: "food 100", UserID: 123})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		first.reports.Lock()
+		defer first.reports.Unlock()
+		return first.reports.invalidations[123] > 0
+	}, time.Second, time.Millisecond)
+
+	err = first.DeliverReport(context.TODO(), reports.requestIDs[0], 123, "W", &repository.Report{MinDate: time.Now()})
+	require.NoError(t, err)
+
+	assert.False(t, server.Exists("gospend:report:123_W"))
+	_, err = second.reportCache.Get("123_W")
+	assert.ErrorIs(t, err, cache.ErrElementNotInCache)
+}
+
+func Test_DeliverReport_EditFailed_ShouldSendNewMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sender := mocks.NewMockMessageSender(ctrl)
+	store := memory.NewMemoryStorage()
+	reports := &countingReportProducer{}
+	editFailedBefore := testutil.ToFloat64(observability.ReportEditFailedCount)
+
+	gomock.InOrder(
+		sender.EXPECT().SendMessageWithID(gomock.Any(), "Preparing report…", int64(123)).Return(1, nil),
+		sender.EXPECT().EditMessage(gomock.Any(), "*Report:* empty", int64(123), 1).
+			Return(errors.New("message to edit not found")),
+		sender.EXPECT().SendMessage(gomock.Any(), "*Report:* empty", int64(123)),
+	)
+
+	model := newTestModel(sender, store, reports)
+	err := model.IncomingMessage(context.TODO(), Message{Text: "/repw", UserID: 123})
+	require.NoError(t, err)
+
+	err = model.DeliverReport(context.TODO(), reports.requestIDs[0], 123, "W", &repository.Report{MinDate: time.Now()})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1., testutil.ToFloat64(observability.ReportEditFailedCount)-editFailedBefore)
+}
+
+func Test_DescribeChange(t *testing.T) {
+	tests := []struct {
+		record   repository.AuditRecord
+		expected string
+	}{
+		{
+			repository.AuditRecord{Entity: repository.AuditSpending, Action: repository.AuditCreate, NewValue: "food 450 20/11/22"},
+			"expense added: food 450 20/11/22",
+		},
+		{
+			repository.AuditRecord{Entity: repository.AuditCategory, Action: repository.AuditDelete, OldValue: "food"},
+			"category removed: food",
+		},
+		{
+			repository.AuditRecord{Entity: repository.AuditLimit, Action: repository.AuditUpdate, OldValue: "1000", NewValue: "2000"},
+			"limit changed: 1000 -> 2000",
+		},
+		{
+			repository.AuditRecord{Entity: repository.AuditCurrency, Action: repository.AuditUpdate, OldValue: "RUB", NewValue: "USD"},
+			"currency changed: RUB -> USD",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, describeChange(&tt.record))
+		})
+	}
+}
+
+// newRedisTestModel создает реплику модели с кэшем рапортов в redis server,
+// инвалидации от других реплик передаются модели
+func newRedisTestModel(t *testing.T, server *miniredis.Miniredis, sender MessageSender,
+	store repository.Storager, reports producer.ReportProducer) *Model {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	var model atomic.Pointer[Model]
+	reportCache, err := cache_redis.New[string, *repository.Report](ctx, wg, "report", 10, 0, cache_redis.Options{
+		Addr: server.Addr(),
+		OnInvalidate: func(key string) {
+			if m := model.Load(); m != nil {
+				m.ReportCacheInvalidated(key)
+			}
+		},
+	})
+	require.NoError(t, err)
+
+	m := New(sender, store,
+		cache_lru.NewLRUCache[int64, string]("currency", 10),
+		reportCache,
+		fixedcurrency.NewFixedCurrencyStorage(nil), reports)
+	model.Store(m)
+	return m
+}
+
+// newTestModel создает модель с кэшами в памяти и фиксированными курсами валют
+func newTestModel(sender MessageSender, store repository.Storager, reports producer.ReportProducer) *Model {
+	return New(sender, store,
+		cache_lru.NewLRUCache[int64, string]("currency", 10),
+		cache_lru.NewLRUCache[string, *repository.Report]("report", 10),
+		fixedcurrency.NewFixedCurrencyStorage(nil), reports)
+}
+
+type countingReportProducer struct {
+	periods    []string
+	requestIDs []string
+}
+
+func (p *countingReportProducer) SendMessage(ctx context.Context, requestID string,
+	userID int64, period string, dateFirst time.Time, dateLast time.Time) error {
+
+	p.periods = append(p.periods, period)
+	p.requestIDs = append(p.requestIDs, requestID)
+	return nil
+}
@@ -0,0 +1,149 @@
+package messages
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Сколько рапорт считается формирующимся, если сервис отчетов его так и не вернул
+const reportPendingWindow = time.Minute
+
+// Рапорт, запрошенный у сервиса отчетов
+type pendingReport struct {
+	// Идентификатор запроса, с которым сервис отчетов возвращает рапорт
+	requestID string
+	started   time.Time
+	// Сообщение "Preparing report…", которое заменяется рапортом, 0 - не отправлено
+	messageID int
+	userID    int64
+	// Счетчик инвалидаций кэша рапортов юзера на момент запроса
+	invalidation uint64
+}
+
+// Рапорты, запрошенные у сервиса отчетов и еще не полученные.
+// Повторный запрос того же рапорта в пределах window не отправляется заново.
+// Запросы хранятся в памяти реплики: рапорт, пришедший в другую реплику,
+// считается неизвестным, поэтому с Kafka рапорты работают только с одной репликой
+type pendingReports struct {
+	sync.Mutex
+	window  time.Duration
+	pending map[string]pendingReport
+	// Счетчики инвалидаций кэша рапортов по юзерам. Нужны только для сравнения
+	// с запросами в работе, поэтому счетчики юзеров без запросов удаляются
+	invalidations map[int64]uint64
+}
+
+func newPendingReports(window time.Duration) *pendingReports {
+	return &pendingReports{
+		window:        window,
+		pending:       make(map[string]pendingReport),
+		invalidations: make(map[int64]uint64),
+	}
+}
+
+// start отмечает рапорт формирующимся и возвращает идентификатор нового запроса.
+// false - рапорт уже формируется, возвращается идентификатор прежнего запроса.
+// Заодно забываются запросы старше window, ответ на которые потерялся
+func (p *pendingReports) start(key string, userID int64, now time.Time) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	users := make(map[int64]bool, len(p.pending))
+	for k, report := range p.pending {
+		if now.Sub(report.started) >= p.window {
+			delete(p.pending, k)
+			continue
+		}
+		users[report.userID] = true
+	}
+	for user := range p.invalidations {
+		if !users[user] {
+			delete(p.invalidations, user)
+		}
+	}
+
+	if report, inProgress := p.pending[key]; inProgress {
+		return report.requestID, false
+	}
+	requestID := newRequestID()
+	p.pending[key] = pendingReport{
+		requestID:    requestID,
+		started:      now,
+		userID:       userID,
+		invalidation: p.invalidations[userID],
+	}
+	return requestID, true
+}
+
+// done снимает отметку, следующий запрос рапорта снова уйдет в сервис отчетов.
+// Отметку снимает только ответ на последний запрос рапорта, пустой requestID
+// (сервис отчетов без идентификаторов запросов) подходит к любому запросу.
+// false - запрос не найден, например ответ опоздал больше чем на window
+func (p *pendingReports) done(key string, requestID string) (pendingReport, bool) {
+	return p.complete(key, requestID, nil)
+}
+
+// complete снимает отметку как done и вызывает cache, если кэш рапортов юзера
+// не инвалидировался после запроса. cache вызывается под блокировкой, поэтому
+// инвалидация не вклинивается между проверкой счетчика и записью в кэш
+func (p *pendingReports) complete(key string, requestID string, cache func()) (pendingReport, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	report, ok := p.pending[key]
+	if !ok || (requestID != "" && requestID != report.requestID) {
+		return pendingReport{}, false
+	}
+	delete(p.pending, key)
+	if cache != nil && p.invalidations[report.userID] == report.invalidation {
+		cache()
+	}
+	return report, true
+}
+
+// setMessageID запоминает сообщение, которое заменяется рапортом по запросу requestID
+func (p *pendingReports) setMessageID(key string, requestID string, messageID int) {
+	p.Lock()
+	defer p.Unlock()
+
+	if report, ok := p.pending[key]; ok && report.requestID == requestID {
+		report.messageID = messageID
+		p.pending[key] = report
+	}
+}
+
+// forgetUser забывает все запросы рапортов юзера, ответы на них
+// считаются неизвестными и не попадают в кэш
+func (p *pendingReports) forgetUser(userID int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	prefix := reportCacheKey(userID, "")
+	for key := range p.pending {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.pending, key)
+		}
+	}
+}
+
+// invalidate отмечает, что кэш рапортов юзера изменился. Рапорты,
+// запрошенные до этого, могут не учитывать изменение и не кэшируются.
+// Без запросов в работе счетчик не с чем сравнивать
+func (p *pendingReports) invalidate(userID int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.pending) > 0 {
+		p.invalidations[userID]++
+	}
+}
+
+// Случайный идентификатор запроса рапорта
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
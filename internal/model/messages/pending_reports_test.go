@@ -0,0 +1,97 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PendingReports_ShouldCoalesceUntilDoneOrWindow(t *testing.T) {
+	now := time.Now()
+	reports := newPendingReports(time.Minute)
+
+	weekly, started := reports.start("123_W", 123, now)
+	assert.True(t, started)
+	coalesced, started := reports.start("123_W", 123, now.Add(time.Second))
+	assert.False(t, started)
+	assert.Equal(t, weekly, coalesced)
+	_, started = reports.start("123_M", 123, now)
+	assert.True(t, started)
+	_, started = reports.start("124_W", 124, now)
+	assert.True(t, started)
+
+	_, ok := reports.done("123_W", weekly)
+	assert.True(t, ok)
+	_, started = reports.start("123_W", 123, now.Add(2*time.Second))
+	assert.True(t, started)
+
+	// Ответ потерялся - после окна запрос отправляется снова
+	_, started = reports.start("123_M", 123, now.Add(time.Minute-time.Second))
+	assert.False(t, started)
+	_, started = reports.start("123_M", 123, now.Add(time.Minute))
+	assert.True(t, started)
+	assert.Len(t, reports.pending, 2)
+}
+
+func Test_PendingReports_ShouldMatchRequestID(t *testing.T) {
+	now := time.Now()
+	reports := newPendingReports(time.Minute)
+	requestID, started := reports.start("123_W", 123, now)
+	require.True(t, started)
+
+	_, ok := reports.done("123_W", "other")
+	assert.False(t, ok)
+	report, ok := reports.done("123_W", requestID)
+	assert.True(t, ok)
+	assert.Equal(t, now, report.started)
+	_, ok = reports.done("123_W", requestID)
+	assert.False(t, ok)
+
+	// Ответ без идентификатора подходит к любому запросу
+	_, started = reports.start("123_W", 123, now)
+	require.True(t, started)
+	_, ok = reports.done("123_W", "")
+	assert.True(t, ok)
+}
+
+func Test_PendingReports_ForgetUser_ShouldKeepOtherUsers(t *testing.T) {
+	now := time.Now()
+	reports := newPendingReports(time.Minute)
+	weekly, _ := reports.start("123_W", 123, now)
+	reports.start("123_M", 123, now)
+	reports.start("1234_W", 1234, now)
+
+	reports.forgetUser(123)
+
+	_, ok := reports.done("123_W", weekly)
+	assert.False(t, ok)
+	_, started := reports.start("123_M", 123, now)
+	assert.True(t, started)
+	_, started = reports.start("1234_W", 1234, now)
+	assert.False(t, started)
+}
+
+func Test_PendingReports_Complete_InvalidatedAfterRequest_ShouldNotCache(t *testing.T) {
+	now := time.Now()
+	reports := newPendingReports(time.Minute)
+	var cached []string
+	weekly, _ := reports.start("123_W", 123, now)
+	monthly, _ := reports.start("123_M", 123, now)
+	other, _ := reports.start("124_W", 124, now)
+
+	reports.invalidate(123)
+	_, ok := reports.complete("123_W", weekly, func() { cached = append(cached, "123_W") })
+	assert.True(t, ok)
+	_, ok = reports.complete("124_W", other, func() { cached = append(cached, "124_W") })
+	assert.True(t, ok)
+	// Рапорт, запрошенный после инвалидации, кэшируется
+	weekly, _ = reports.start("123_W", 123, now)
+	_, ok = reports.complete("123_W", weekly, func() { cached = append(cached, "123_W") })
+	assert.True(t, ok)
+	_, ok = reports.complete("123_M", monthly, func() { cached = append(cached, "123_M") })
+	assert.True(t, ok)
+
+	assert.Equal(t, []string{"124_W", "123_W"}, cached)
+}
@@ -0,0 +1,154 @@
+package messages
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	errTextSpendingNoAmount        = errors.New("amount not found")
+	errTextSpendingAmbiguousAmount = errors.New("amount is ambiguous")
+	errTextSpendingNoCategory      = errors.New("category not found")
+)
+
+// Относительные даты: смещение в днях назад от текущей даты
+var relativeDays = map[string]int{
+	"today":     0,
+	"сегодня":   0,
+	"yesterday": 1,
+	"вчера":     1,
+	"позавчера": 2,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":      time.Sunday,
+	"воскресенье": time.Sunday,
+	"monday":      time.Monday,
+	"понедельник": time.Monday,
+	"tuesday":     time.Tuesday,
+	"вторник":     time.Tuesday,
+	"wednesday":   time.Wednesday,
+	"среда":       time.Wednesday,
+	"среду":       time.Wednesday,
+	"thursday":    time.Thursday,
+	"четверг":     time.Thursday,
+	"friday":      time.Friday,
+	"пятница":     time.Friday,
+	"пятницу":     time.Friday,
+	"saturday":    time.Saturday,
+	"суббота":     time.Saturday,
+	"субботу":     time.Saturday,
+}
+
+// Предлоги перед датой, не относящиеся к названию категории: "в среду", "on monday"
+var datePrepositions = map[string]bool{
+	"в":    true,
+	"во":   true,
+	"on":   true,
+	"last": true,
+}
+
+// Форматы абсолютных дат, первый совпадает с форматом команды /addexp
+var dateLayouts = []string{"02/01/06", "02.01.06", "02.01.2006"}
+
+type textSpending struct {
+	CategoryName string
+	Amount       decimal.Decimal
+	Date         time.Time
+}
+
+// parseTextSpending разбирает сообщение вида "coffee 250" или "taxi 700 yesterday"
+// в категорию, сумму и дату траты. Сумма - число после названия категории,
+// несколько чисел подряд в конце ("taxi 700 2") не разбираются
+// Дата может быть абсолютной (dd/mm/yy), относительной (вчера, позавчера)
+// или днем недели (последний прошедший, не сегодняшний)
+func parseTextSpending(text string, now time.Time) (*textSpending, error) {
+	elements := strings.Fields(text)
+
+	date := now
+	dateFound := false
+	amountIndex := -1
+	var amount decimal.Decimal
+
+	category := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if !dateFound {
+			if d, ok := parseTextDate(element, now); ok {
+				date = d
+				dateFound = true
+				last := len(category) - 1
+				if last >= 0 && datePrepositions[strings.ToLower(category[last])] {
+					category = category[:last]
+				}
+				continue
+			}
+		}
+		category = append(category, element)
+	}
+
+	// Сумма - единственное число в конце сообщения
+	for i := len(category) - 1; i >= 0; i-- {
+		value, err := decimal.NewFromString(strings.Replace(category[i], ",", ".", 1))
+		if err != nil {
+			break
+		}
+		if amountIndex >= 0 {
+			return nil, errTextSpendingAmbiguousAmount
+		}
+		amount = value
+		amountIndex = i
+	}
+	if amountIndex < 0 || !amount.IsPositive() {
+		return nil, errTextSpendingNoAmount
+	}
+	category = category[:amountIndex]
+
+	categoryName := strings.TrimSpace(strings.Join(category, " "))
+	if categoryName == "" {
+		return nil, errTextSpendingNoCategory
+	}
+
+	return &textSpending{
+		CategoryName: categoryName,
+		Amount:       amount,
+		Date:         date,
+	}, nil
+}
+
+// parseTextDate распознает одно слово сообщения как дату траты
+func parseTextDate(word string, now time.Time) (time.Time, bool) {
+	word = strings.ToLower(strings.Trim(word, ",."))
+
+	if days, inMap := relativeDays[word]; inMap {
+		return now.AddDate(0, 0, -days), true
+	}
+
+	if weekday, inMap := weekdays[word]; inMap {
+		// Сегодняшний день недели - это неделю назад, для сегодня есть "today"
+		days := (int(now.Weekday()) - int(weekday) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return now.AddDate(0, 0, -days), true
+	}
+
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, word); err == nil {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// isTextSpending проверяет, похоже ли сообщение без команды на трату
+func isTextSpending(text string) bool {
+	if text == "" || strings.HasPrefix(text, "/") {
+		return false
+	}
+	_, err := parseTextSpending(text, time.Now())
+	return err == nil
+}
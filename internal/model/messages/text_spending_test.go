@@ -0,0 +1,71 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// среда, 19 октября 2022
+var textSpendingNow = time.Date(2022, time.October, 19, 15, 30, 0, 0, time.UTC)
+
+func Test_ParseTextSpending_ValidText_ShouldReturnSpending(t *testing.T) {
+	tests := []struct {
+		text     string
+		category string
+		amount   string
+		date     time.Time
+	}{
+		{"coffee 250", "coffee", "250", textSpendingNow},
+		{"taxi 700 yesterday", "taxi", "700", textSpendingNow.AddDate(0, 0, -1)},
+		{"кофе с собой 180,50 позавчера", "кофе с собой", "180.5", textSpendingNow.AddDate(0, 0, -2)},
+		{"Вчера обед 450", "обед", "450", textSpendingNow.AddDate(0, 0, -1)},
+		{"lunch 300 on monday", "lunch", "300", textSpendingNow.AddDate(0, 0, -2)},
+		{"книги 900 в среду", "книги", "900", textSpendingNow.AddDate(0, 0, -7)},
+		{"книги 900 сегодня", "книги", "900", textSpendingNow},
+		{"продукты 1200 пятницу", "продукты", "1200", textSpendingNow.AddDate(0, 0, -5)},
+		{"7 eleven 99 01/10/22", "7 eleven", "99", time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			spending, err := parseTextSpending(tt.text, textSpendingNow)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.category, spending.CategoryName)
+				assert.True(t, decimal.RequireFromString(tt.amount).Equal(spending.Amount))
+				assert.Equal(t, tt.date, spending.Date)
+			}
+		})
+	}
+}
+
+func Test_ParseTextSpending_InvalidText_ShouldReturnError(t *testing.T) {
+	tests := []struct {
+		text string
+		err  error
+	}{
+		{"some text", errTextSpendingNoAmount},
+		{"coffee -250", errTextSpendingNoAmount},
+		{"250", errTextSpendingNoCategory},
+		{"250 yesterday", errTextSpendingNoCategory},
+		{"", errTextSpendingNoAmount},
+		{"I have 2 questions", errTextSpendingNoAmount},
+		{"taxi 700 2", errTextSpendingAmbiguousAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := parseTextSpending(tt.text, textSpendingNow)
+
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func Test_IsTextSpending_Command_ShouldReturnFalse(t *testing.T) {
+	assert.False(t, isTextSpending("/addexp coffee 250"))
+	assert.True(t, isTextSpending("coffee 250"))
+}
@@ -38,6 +38,103 @@ var (
 		[]string{"result"},
 	)
 
+	// updates queue metrics
+	UpdatesQueueSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "updates_queue_size",
+		},
+	)
+	UpdatesQueueFullCount = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "updates_queue_full_total",
+		},
+	)
+	UpdatesDroppedCount = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "updates_dropped_total",
+		},
+	)
+	HistogramUpdatesQueueTime = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "histogram_updates_queue_time_seconds",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10},
+		},
+	)
+
+	// outgoing messages metrics
+	OutgoingQueueSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "outgoing_queue_size",
+		},
+	)
+	OutgoingQueuedCount = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "outgoing_queued_total",
+		},
+	)
+	OutgoingDroppedCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "outgoing_dropped_total",
+		},
+		[]string{"reason"},
+	)
+	OutgoingRetryCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "outgoing_retry_total",
+		},
+		[]string{"reason"},
+	)
+
+	// report requests metrics
+	ReportCoalescedCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "report_coalesced_total",
+		},
+		[]string{"period"},
+	)
+	HistogramReportRoundTripTimeVec = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "histogram_report_round_trip_time_seconds",
+			Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+		},
+		[]string{"period"},
+	)
+	ReportUnmatchedCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "report_unmatched_total",
+		},
+		[]string{"period"},
+	)
+	ReportEditFailedCount = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "report_edit_failed_total",
+		},
+	)
+
 	// cache metrics
 	CacheKeyCountVec = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -63,6 +160,31 @@ var (
 		},
 		[]string{"cache_name"},
 	)
+	CacheMissCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "cache_miss_count_total",
+		},
+		[]string{"cache_name"},
+	)
+	CacheExpiredCountVec = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "cache_expired_count_total",
+		},
+		[]string{"cache_name"},
+	)
+	HistogramCacheTimeVec = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ozon",
+			Subsystem: "telegram",
+			Name:      "histogram_cache_time_vec_seconds",
+			Buckets:   []float64{0.000001, 0.000005, 0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.01},
+		},
+		[]string{"cache_name", "operation"},
+	)
 )
 
 type MetricsServer struct {
@@ -5,7 +5,8 @@ import (
 	"go.uber.org/zap"
 )
 
-func InitTracing(logger *zap.Logger) {
+// InitTracing задает глобальный трейсер, serviceName - имя сервиса в трейсах
+func InitTracing(logger *zap.Logger, serviceName string) {
 	cfg := config.Configuration{
 		Sampler: &config.SamplerConfig{
 			Type:  "const",
@@ -15,7 +16,7 @@ func InitTracing(logger *zap.Logger) {
 			LocalAgentHostPort: "host.docker.internal:6831",
 		},
 	}
-	_, err := cfg.InitGlobalTracer("gospend-bot")
+	_, err := cfg.InitGlobalTracer(serviceName)
 	if err != nil {
 		logger.Fatal("cannot init tracing", zap.Error(err))
 	}
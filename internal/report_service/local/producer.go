@@ -0,0 +1,97 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+// Ограничение времени формирования одного отчета
+const reportTimeout = 30 * time.Second
+
+type ReceiveFunc func(ctx context.Context, requestID string,
+	userID int64, period string, report *repository.Report) error
+
+// Producer формирует отчеты в процессе бота вместо сервиса отчетов через Kafka,
+// чтобы бот мог работать одним бинарником. Как и сервис отчетов,
+// отчет формируется асинхронно и передается в receive
+type Producer struct {
+	store   repository.Storager
+	logger  *zap.Logger
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	receive ReceiveFunc
+}
+
+func New(store repository.Storager, logger *zap.Logger) *Producer {
+	return &Producer{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// SetReceiver задает получателя отчетов. Модель сообщений создается после
+// продюсера, поэтому получатель задается отдельно
+func (p *Producer) SetReceiver(receive ReceiveFunc) {
+	p.mu.Lock()
+	p.receive = receive
+	p.mu.Unlock()
+}
+
+func (p *Producer) SendMessage(ctx context.Context, requestID string,
+	userID int64, period string, dateFirst time.Time, dateLast time.Time) error {
+
+	// Отчет формируется после ответа на команду, его трейс следует за трейсом запроса
+	var options []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		options = append(options, opentracing.FollowsFrom(parent.Context()))
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		span := opentracing.StartSpan("prepare report", options...)
+		span.SetTag("request_id", requestID)
+		defer span.Finish()
+
+		ctx, cancel := context.WithTimeout(opentracing.ContextWithSpan(context.Background(), span), reportTimeout)
+		defer cancel()
+
+		if err := p.process(ctx, requestID, userID, period, dateFirst, dateLast); err != nil {
+			p.logger.Error("local report failed",
+				zap.String("request_id", requestID),
+				zap.Int64("user_id", userID),
+				zap.String("period", period),
+				zap.Error(err),
+			)
+		}
+	}()
+	return nil
+}
+
+func (p *Producer) process(ctx context.Context, requestID string, userID int64, period string,
+	dateFirst time.Time, dateLast time.Time) error {
+
+	report, err := p.store.ReportPeriod(ctx, userID, dateFirst, dateLast)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	receive := p.receive
+	p.mu.RUnlock()
+	if receive == nil {
+		return nil
+	}
+	return receive(ctx, requestID, userID, period, report)
+}
+
+// Wait дожидается отправки всех запрошенных отчетов
+func (p *Producer) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,46 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/memory"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestProducer_SendMessage_ShouldDeliverReport(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := memory.NewMemoryStorage()
+	require.NoError(t, store.CreateSpending(ctx, 1, "food", decimal.NewFromInt(100), now))
+
+	var mu sync.Mutex
+	var received []*repository.Report
+	p := New(store, zap.NewNop())
+	p.SetReceiver(func(ctx context.Context, requestID string,
+		userID int64, period string, report *repository.Report) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "req-1", requestID)
+		assert.Equal(t, int64(1), userID)
+		assert.Equal(t, "W", period)
+		received = append(received, report)
+		return nil
+	})
+
+	err := p.SendMessage(ctx, "req-1", 1, "W", now.AddDate(0, 0, -7), now)
+	p.Wait()
+
+	assert.NoError(t, err)
+	if assert.Len(t, received, 1) && assert.Len(t, received[0].ReportByCategory, 1) {
+		assert.Equal(t, "food", received[0].ReportByCategory[0].CategoryName)
+		assert.True(t, decimal.NewFromInt(100).Equal(received[0].ReportByCategory[0].Sum))
+	}
+}
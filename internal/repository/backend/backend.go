@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/cr00z/goSpendingBot/internal/migrate"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/memory"
+	"github.com/cr00z/goSpendingBot/internal/repository/postgres_gorm"
+	"github.com/cr00z/goSpendingBot/internal/repository/postgres_sql"
+	"github.com/cr00z/goSpendingBot/internal/repository/sqlite"
+	"github.com/cr00z/goSpendingBot/migrations"
+	"github.com/pkg/errors"
+)
+
+const (
+	TypePostgresSQL  = "postgres_sql"
+	TypePostgresGorm = "postgres_gorm"
+	TypeSqlite       = "sqlite"
+	TypeMemory       = "memory"
+)
+
+const defaultSqlitePath = "spendings.db"
+
+var (
+	ErrUnknownStorage = errors.New("unknown storage type")
+	ErrNoMigrations   = errors.New("storage has no migrations")
+)
+
+type Options struct {
+	// Тип хранилища, по умолчанию postgres_sql
+	Type string
+	// Файл с параметрами подключения к postgres
+	EnvFile string
+	// Файл базы sqlite, по умолчанию spendings.db
+	SqlitePath string
+	// Вывод goose при применении миграций
+	MigrateOutput io.Writer
+}
+
+// Open создает хранилище выбранного в конфиге типа
+// и применяет к его базе непримененные миграции
+func Open(ctx context.Context, options Options) (repository.Storager, error) {
+	if options.Type == TypeMemory {
+		return memory.NewMemoryStorage(), nil
+	}
+
+	db, migrator, err := openDB(options)
+	if err != nil {
+		return nil, err
+	}
+
+	output := options.MigrateOutput
+	if output == nil {
+		output = io.Discard
+	}
+	if err = migrator.Up(ctx, output); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	switch options.Type {
+	case TypeSqlite:
+		return sqlite.New(db), nil
+
+	case TypePostgresGorm:
+		gormDB, err := postgres_gorm.Open(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return postgres_gorm.New(gormDB), nil
+	}
+
+	return postgres_sql.New(db), nil
+}
+
+// Migrate выполняет команду миграций up, down или status над базой хранилища
+func Migrate(ctx context.Context, options Options, command string, out io.Writer) error {
+	if options.Type == TypeMemory {
+		return errors.Wrap(ErrNoMigrations, options.Type)
+	}
+
+	db, migrator, err := openDB(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return migrator.Run(ctx, command, out)
+}
+
+func openDB(options Options) (*sql.DB, *migrate.Migrator, error) {
+	switch options.Type {
+	case "", TypePostgresSQL, TypePostgresGorm:
+		db, err := postgres_sql.OpenAndConnect(options.EnvFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, migrate.New(db, migrate.DialectPostgres, migrations.Postgres), nil
+
+	case TypeSqlite:
+		path := options.SqlitePath
+		if path == "" {
+			path = defaultSqlitePath
+		}
+		db, err := sqlite.OpenAndConnect(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, migrate.New(db, migrate.DialectSqlite, migrations.Sqlite), nil
+	}
+
+	return nil, nil, errors.Wrap(ErrUnknownStorage, options.Type)
+}
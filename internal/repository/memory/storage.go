@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"context"
 	"sort"
 	"sync"
 	"time"
@@ -9,13 +10,26 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+const defaultCurrency = "RUB"
+
 type MemoryStorage struct {
 	sync.Mutex
 	categories     map[int64]*repository.Category
 	spendings      map[int64]*repository.Spending
 	currency       map[int64]string
+	limits         map[int64]decimal.Decimal
+	audit          []*repository.AuditRecord
+	deletions      []deletion
 	nextCategoryID int64
 	nextSpendingID int64
+	nextAuditID    int64
+}
+
+// deletion - обезличенная запись об удалении данных юзера
+type deletion struct {
+	categories int
+	spendings  int
+	createdAt  time.Time
 }
 
 func NewMemoryStorage() *MemoryStorage {
@@ -23,138 +37,500 @@ func NewMemoryStorage() *MemoryStorage {
 	ms.categories = make(map[int64]*repository.Category)
 	ms.spendings = make(map[int64]*repository.Spending)
 	ms.currency = make(map[int64]string)
-	ms.nextCategoryID = 0
-	ms.nextSpendingID = 0
+	ms.limits = make(map[int64]decimal.Decimal)
+	ms.nextCategoryID = 1
+	ms.nextSpendingID = 1
 	return ms
 }
 
 // CreateSpending добавляет новую затрату в хранилище
-func (ms *MemoryStorage) CreateSpending(userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
-	category, inStor := ms.GetCategory(userID, categoryName)
-	categoryID := category.ID
+func (ms *MemoryStorage) CreateSpending(ctx context.Context,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
 
 	ms.Lock()
 	defer ms.Unlock()
 
-	if !inStor {
-		ms.categories[ms.nextCategoryID] = &repository.Category{
-			ID:     ms.nextCategoryID,
-			UserID: userID,
-			Name:   categoryName,
+	// Проверка лимита: траты с начала месяца вместе с новой не должны его превышать
+	if limit, inMap := ms.limits[userID]; inMap {
+		now := time.Now()
+		currentYear, currentMonth, _ := now.Date()
+		firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, now.Location())
+
+		summ := ms.sumPeriod(userID, firstOfMonth, now)
+		if limit.LessThan(summ.Add(amount)) {
+			return repository.ErrLimitExceeded
 		}
-		categoryID = ms.nextCategoryID
-		ms.nextCategoryID++
 	}
 
+	ms.createSpending(userID, categoryName, amount, date)
+	return nil
+}
+
+// createSpending добавляет трату без проверки лимита, категория создается при необходимости
+func (ms *MemoryStorage) createSpending(userID int64, categoryName string, amount decimal.Decimal, date time.Time) {
+	category, inStor := ms.getCategory(userID, categoryName)
+	if !inStor {
+		category = ms.createCategory(userID, categoryName)
+	}
+
+	now := time.Now()
 	ms.spendings[ms.nextSpendingID] = &repository.Spending{
 		ID:         ms.nextSpendingID,
 		UserID:     userID,
-		CategoryId: int(categoryID),
+		CategoryId: int(category.ID),
 		Amount:     amount,
 		Date:       date,
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
+	ms.writeAudit(repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditSpending,
+		EntityID: ms.nextSpendingID,
+		Action:   repository.AuditCreate,
+		NewValue: repository.SpendingAuditValue(categoryName, amount, date),
+	})
 	ms.nextSpendingID++
-
-	return nil
 }
 
-func (ms *MemoryStorage) GetCategory(userID int64, name string) (*repository.Category, bool) {
+// GetCategory возвращает категорию юзера по имени
+func (ms *MemoryStorage) GetCategory(ctx context.Context,
+	userID int64, name string) (*repository.Category, bool, error) {
+
 	ms.Lock()
 	defer ms.Unlock()
 
+	category, inStor := ms.getCategory(userID, name)
+	if !inStor {
+		return nil, false, nil
+	}
+	cat := *category
+	return &cat, true, nil
+}
+
+func (ms *MemoryStorage) getCategory(userID int64, name string) (*repository.Category, bool) {
 	for _, cat := range ms.categories {
-		if cat.UserID == userID && cat.Name == name {
+		if cat.UserID == userID && cat.Name == name && cat.DeletedAt == nil {
 			return cat, true
 		}
 	}
-	return &repository.Category{}, false
+	return nil, false
 }
 
-// CreateCategory создает новую категорию в хранилище
-func (ms *MemoryStorage) CreateCategory(userID int64, name string) error {
-	if _, inStor := ms.GetCategory(userID, name); inStor {
-		return repository.ErrCategoryExists
+func (ms *MemoryStorage) createCategory(userID int64, name string) *repository.Category {
+	now := time.Now()
+	category := &repository.Category{
+		ID:        ms.nextCategoryID,
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
+	ms.categories[ms.nextCategoryID] = category
+	ms.writeAudit(repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditCategory,
+		EntityID: ms.nextCategoryID,
+		Action:   repository.AuditCreate,
+		NewValue: name,
+	})
+	ms.nextCategoryID++
+	return category
+}
 
+// CreateCategory создает новую категорию в хранилище
+func (ms *MemoryStorage) CreateCategory(ctx context.Context, userID int64, name string) error {
 	ms.Lock()
 	defer ms.Unlock()
 
-	ms.categories[ms.nextCategoryID] = &repository.Category{
-		ID:     ms.nextCategoryID,
-		UserID: userID,
-		Name:   name,
+	if _, inStor := ms.getCategory(userID, name); inStor {
+		return repository.ErrCategoryExists
 	}
-	ms.nextCategoryID++
+	ms.createCategory(userID, name)
 
 	return nil
 }
 
-// GetAllCategories возвращает из хранилища все категории
-func (ms *MemoryStorage) GetAllCategories(userID int64) ([]*repository.Category, error) {
+// GetAllCategories возвращает из хранилища все категории, упорядоченные по имени
+func (ms *MemoryStorage) GetAllCategories(ctx context.Context, userID int64) ([]*repository.Category, error) {
 	ms.Lock()
 	defer ms.Unlock()
 
-	ids := make([]int, 0)
-	for id := range ms.categories {
-		if ms.categories[id].UserID == userID {
-			ids = append(ids, int(id))
+	return ms.getAllCategories(userID), nil
+}
+
+func (ms *MemoryStorage) getAllCategories(userID int64) []*repository.Category {
+	var result []*repository.Category
+	for _, cat := range ms.categories {
+		if cat.UserID == userID && cat.DeletedAt == nil {
+			category := *cat
+			result = append(result, &category)
 		}
 	}
-	sort.Ints(ids)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
 
-	result := make([]*repository.Category, 0, len(ids))
-	for id := range ids {
-		result = append(result, ms.categories[int64(id)])
+// sumPeriod возвращает сумму трат юзера за период, границы включаются
+func (ms *MemoryStorage) sumPeriod(userID int64, dateFirst time.Time, dateLast time.Time) decimal.Decimal {
+	var summ decimal.Decimal
+	for _, sp := range ms.spendings {
+		if sp.UserID == userID && sp.DeletedAt == nil && inPeriod(sp.Date, dateFirst, dateLast) {
+			summ = summ.Add(sp.Amount)
+		}
 	}
-	return result, nil
+	return summ
+}
+
+func inPeriod(date time.Time, dateFirst time.Time, dateLast time.Time) bool {
+	return !date.Before(dateFirst) && !date.After(dateLast)
 }
 
 // ReportPeriod возвращает отчет за период по каждой категории
-func (ms *MemoryStorage) ReportPeriod(userID int64, dateFirst time.Time, dateLast time.Time) ([]*repository.ReportByCategory, error) {
-	reportMap := make(map[int64]decimal.Decimal)
+func (ms *MemoryStorage) ReportPeriod(ctx context.Context,
+	userID int64, dateFirst time.Time, dateLast time.Time) (*repository.Report, error) {
 
 	ms.Lock()
+	defer ms.Unlock()
+
+	report := repository.Report{
+		ReportByCategory: make([]*repository.ReportByCategory, 0),
+		MinDate:          time.Now(),
+	}
+
+	reportMap := make(map[int64]decimal.Decimal)
 	for _, sp := range ms.spendings {
-		if sp.UserID == userID && sp.Date.After(dateFirst) && sp.Date.Before(dateLast) {
+		if sp.UserID == userID && sp.DeletedAt == nil && inPeriod(sp.Date, dateFirst, dateLast) {
 			reportMap[int64(sp.CategoryId)] = reportMap[int64(sp.CategoryId)].Add(sp.Amount)
+			if sp.Date.Before(report.MinDate) {
+				report.MinDate = sp.Date
+			}
 		}
 	}
-	ms.Unlock()
-
-	categories, err := ms.GetAllCategories(userID)
-	if err != nil {
-		return nil, err
-	}
 
-	report := make([]*repository.ReportByCategory, 0, len(categories))
-	for _, cat := range categories {
-		if !reportMap[cat.ID].IsZero() {
-			report = append(report, &repository.ReportByCategory{
+	for _, cat := range ms.getAllCategories(userID) {
+		if reportMap[cat.ID].IsPositive() {
+			report.ReportByCategory = append(report.ReportByCategory, &repository.ReportByCategory{
 				CategoryName: cat.Name,
 				Sum:          reportMap[cat.ID],
 			})
 		}
 	}
 
-	return report, nil
+	return &report, nil
 }
 
 // GetActiveCurrency возвращает используемую юзером валюту
-func (ms *MemoryStorage) GetActiveCurrency(userID int64) (curr string) {
+func (ms *MemoryStorage) GetActiveCurrency(ctx context.Context, userID int64) (string, error) {
 	ms.Lock()
 	defer ms.Unlock()
+
 	curr, inMap := ms.currency[userID]
 	if !inMap {
-		curr = "RUB"
-		ms.currency[userID] = "RUB"
+		curr = defaultCurrency
+		ms.currency[userID] = curr
 	}
-	return curr
+	return curr, nil
 }
 
 // SetActiveCurrency устанавливает используемую юзером валюту
-func (ms *MemoryStorage) SetActiveCurrency(userID int64, curr string) error {
+func (ms *MemoryStorage) SetActiveCurrency(ctx context.Context, userID int64, curr string) error {
 	ms.Lock()
+	defer ms.Unlock()
+
+	ms.setActiveCurrency(userID, curr, 0)
+	return nil
+}
+
+func (ms *MemoryStorage) setActiveCurrency(userID int64, curr string, revertsID int64) {
+	oldCurr, inMap := ms.currency[userID]
+	if !inMap {
+		oldCurr = defaultCurrency
+	}
 	ms.currency[userID] = curr
-	ms.Unlock()
+	ms.writeAudit(repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditCurrency,
+		Action:    repository.AuditUpdate,
+		OldValue:  oldCurr,
+		NewValue:  curr,
+		RevertsID: revertsID,
+	})
+}
+
+// GetLimit возвращает лимит трат в месяц
+func (ms *MemoryStorage) GetLimit(ctx context.Context, userID int64) (decimal.Decimal, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	limit, inMap := ms.limits[userID]
+	if !inMap {
+		return limit, repository.ErrLimitNotSet
+	}
+	return limit, nil
+}
+
+// SetLimit устанавливает лимит трат в месяц
+func (ms *MemoryStorage) SetLimit(ctx context.Context, userID int64, amount decimal.Decimal) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.setLimit(userID, amount, 0)
 	return nil
 }
+
+func (ms *MemoryStorage) setLimit(userID int64, amount decimal.Decimal, revertsID int64) {
+	record := repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditCreate,
+		NewValue:  amount.String(),
+		RevertsID: revertsID,
+	}
+	if limit, inMap := ms.limits[userID]; inMap {
+		record.Action = repository.AuditUpdate
+		record.OldValue = limit.String()
+	}
+	ms.limits[userID] = amount
+	ms.writeAudit(record)
+}
+
+// DropLimit устанавливает неограниченный лимит трат в месяц
+func (ms *MemoryStorage) DropLimit(ctx context.Context, userID int64) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.dropLimit(userID, 0)
+	return nil
+}
+
+func (ms *MemoryStorage) dropLimit(userID int64, revertsID int64) {
+	if limit, inMap := ms.limits[userID]; inMap {
+		delete(ms.limits, userID)
+		ms.writeAudit(repository.AuditRecord{
+			UserID:    userID,
+			Entity:    repository.AuditLimit,
+			Action:    repository.AuditDelete,
+			OldValue:  limit.String(),
+			RevertsID: revertsID,
+		})
+	}
+}
+
+// GetHistory возвращает последние limit записей журнала изменений, новые первыми
+func (ms *MemoryStorage) GetHistory(ctx context.Context, userID int64, limit int) ([]*repository.AuditRecord, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	var history []*repository.AuditRecord
+	for i := len(ms.audit) - 1; i >= 0 && len(history) < limit; i-- {
+		if ms.audit[i].UserID == userID {
+			record := *ms.audit[i]
+			history = append(history, &record)
+		}
+	}
+	return history, nil
+}
+
+// Undo отменяет последнее неотмененное изменение юзера, сделанное не раньше window назад,
+// и возвращает отмененную запись журнала
+func (ms *MemoryStorage) Undo(ctx context.Context, userID int64, window time.Duration) (*repository.AuditRecord, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	reverted := make(map[int64]bool)
+	for _, record := range ms.audit {
+		if record.UserID == userID && record.RevertsID != 0 {
+			reverted[record.RevertsID] = true
+		}
+	}
+
+	since := time.Now().Add(-window)
+	for i := len(ms.audit) - 1; i >= 0; i-- {
+		record := ms.audit[i]
+		if record.UserID != userID || record.RevertsID != 0 || reverted[record.ID] {
+			continue
+		}
+		if record.CreatedAt.Before(since) {
+			break
+		}
+
+		ms.revert(record)
+		undone := *record
+		return &undone, nil
+	}
+
+	return nil, repository.ErrNothingToUndo
+}
+
+// revert записывает изменение, обратное record
+func (ms *MemoryStorage) revert(record *repository.AuditRecord) {
+	now := time.Now()
+
+	switch record.Entity {
+	case repository.AuditSpending:
+		sp, inMap := ms.spendings[record.EntityID]
+		if inMap && sp.DeletedAt == nil {
+			sp.DeletedAt = &now
+			sp.UpdatedAt = now
+		}
+		ms.writeAudit(repository.AuditRecord{
+			UserID:    record.UserID,
+			Entity:    repository.AuditSpending,
+			EntityID:  record.EntityID,
+			Action:    repository.AuditDelete,
+			OldValue:  record.NewValue,
+			RevertsID: record.ID,
+		})
+
+	case repository.AuditCategory:
+		cat, inMap := ms.categories[record.EntityID]
+		if inMap && cat.DeletedAt == nil {
+			cat.DeletedAt = &now
+			cat.UpdatedAt = now
+		}
+		ms.writeAudit(repository.AuditRecord{
+			UserID:    record.UserID,
+			Entity:    repository.AuditCategory,
+			EntityID:  record.EntityID,
+			Action:    repository.AuditDelete,
+			OldValue:  record.NewValue,
+			RevertsID: record.ID,
+		})
+
+	case repository.AuditLimit:
+		if record.OldValue == "" {
+			ms.dropLimit(record.UserID, record.ID)
+		} else {
+			ms.setLimit(record.UserID, decimal.RequireFromString(record.OldValue), record.ID)
+		}
+
+	case repository.AuditCurrency:
+		ms.setActiveCurrency(record.UserID, record.OldValue, record.ID)
+	}
+}
+
+// ExportUserData возвращает все данные юзера для резервной копии
+func (ms *MemoryStorage) ExportUserData(ctx context.Context, userID int64) (*repository.UserData, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	data := &repository.UserData{
+		Spendings: ms.getAllSpendings(userID),
+		Currency:  defaultCurrency,
+	}
+	for _, cat := range ms.getAllCategories(userID) {
+		data.Categories = append(data.Categories, cat.Name)
+	}
+	if limit, inMap := ms.limits[userID]; inMap {
+		data.Limit = &limit
+	}
+	if curr, inMap := ms.currency[userID]; inMap {
+		data.Currency = curr
+	}
+	return data, nil
+}
+
+// getAllSpendings возвращает траты юзера, упорядоченные по дате
+func (ms *MemoryStorage) getAllSpendings(userID int64) []*repository.SpendingData {
+	var spendings []*repository.Spending
+	for _, sp := range ms.spendings {
+		if sp.UserID == userID && sp.DeletedAt == nil {
+			spendings = append(spendings, sp)
+		}
+	}
+	sort.Slice(spendings, func(i, j int) bool {
+		if spendings[i].Date.Equal(spendings[j].Date) {
+			return spendings[i].ID < spendings[j].ID
+		}
+		return spendings[i].Date.Before(spendings[j].Date)
+	})
+
+	result := make([]*repository.SpendingData, 0, len(spendings))
+	for _, sp := range spendings {
+		result = append(result, &repository.SpendingData{
+			CategoryName: ms.categories[int64(sp.CategoryId)].Name,
+			Amount:       sp.Amount,
+			Date:         sp.Date,
+		})
+	}
+	return result
+}
+
+// ImportUserData добавляет юзеру данные из резервной копии, которых у него еще нет.
+// Лимит при загрузке трат не проверяется
+func (ms *MemoryStorage) ImportUserData(ctx context.Context,
+	userID int64, data *repository.UserData) (*repository.ImportResult, error) {
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	categoriesBefore := len(ms.getAllCategories(userID))
+	for _, name := range data.Categories {
+		if _, inStor := ms.getCategory(userID, name); !inStor {
+			ms.createCategory(userID, name)
+		}
+	}
+	missing := repository.MissingSpendings(ms.getAllSpendings(userID), data.Spendings)
+	for _, sp := range missing {
+		ms.createSpending(userID, sp.CategoryName, sp.Amount, sp.Date)
+	}
+	if limit, inMap := ms.limits[userID]; data.Limit != nil && !(inMap && limit.Equal(*data.Limit)) {
+		ms.setLimit(userID, *data.Limit, 0)
+	}
+	curr, inMap := ms.currency[userID]
+	if !inMap {
+		curr = defaultCurrency
+	}
+	if data.Currency != "" && data.Currency != curr {
+		ms.setActiveCurrency(userID, data.Currency, 0)
+	}
+	return &repository.ImportResult{
+		Categories: len(ms.getAllCategories(userID)) - categoriesBefore,
+		Spendings:  len(missing),
+	}, nil
+}
+
+// DeleteUserData удаляет все данные юзера вместе с журналом изменений
+// и записывает обезличенное событие удаления
+func (ms *MemoryStorage) DeleteUserData(ctx context.Context, userID int64) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	var event deletion
+	for id, cat := range ms.categories {
+		if cat.UserID == userID {
+			delete(ms.categories, id)
+			event.categories++
+		}
+	}
+	for id, sp := range ms.spendings {
+		if sp.UserID == userID {
+			delete(ms.spendings, id)
+			event.spendings++
+		}
+	}
+	delete(ms.currency, userID)
+	delete(ms.limits, userID)
+
+	audit := ms.audit[:0]
+	for _, record := range ms.audit {
+		if record.UserID != userID {
+			audit = append(audit, record)
+		}
+	}
+	ms.audit = audit
+
+	event.createdAt = time.Now()
+	ms.deletions = append(ms.deletions, event)
+	return nil
+}
+
+func (ms *MemoryStorage) writeAudit(record repository.AuditRecord) {
+	ms.nextAuditID++
+	record.ID = ms.nextAuditID
+	record.CreatedAt = time.Now()
+	ms.audit = append(ms.audit, &record)
+}
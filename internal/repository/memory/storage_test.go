@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/storagertest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_Storager(t *testing.T) {
+	storagertest.Run(t, func(t *testing.T) repository.Storager {
+		return NewMemoryStorage()
+	})
+}
+
+func TestMemoryStorage_DeleteUserData_ShouldRecordAnonymousEvent(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStorage()
+	require.NoError(t, ms.CreateCategory(ctx, 1, "taxi"))
+	require.NoError(t, ms.CreateSpending(ctx, 1, "food", decimal.NewFromInt(100), time.Now()))
+
+	require.NoError(t, ms.DeleteUserData(ctx, 1))
+
+	if assert.Len(t, ms.deletions, 1) {
+		assert.Equal(t, 2, ms.deletions[0].categories)
+		assert.Equal(t, 1, ms.deletions[0].spendings)
+	}
+}
@@ -1,14 +1,130 @@
 package postgres_gorm
 
 import (
-	"errors"
+	"context"
+	"database/sql"
 	"time"
 
 	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/postgres_sql"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
 )
 
+const defaultCurrency = "RUB"
+
+// Модели GORM повторяют схему из migrations, поэтому отделены от repository
+
+type category struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func (category) TableName() string {
+	return "categories"
+}
+
+type spending struct {
+	ID         int64
+	UserID     int64
+	CategoryID int64
+	Amount     decimal.Decimal
+	Date       time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt
+}
+
+func (spending) TableName() string {
+	return "spendings"
+}
+
+type currency struct {
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	CharCode  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (currency) TableName() string {
+	return "currencies"
+}
+
+type limit struct {
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	Amount    decimal.Decimal
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (limit) TableName() string {
+	return "limits"
+}
+
+// daily - дневной агрегат трат юзера по категории
+type daily struct {
+	UserID     int64  `gorm:"primaryKey;autoIncrement:false"`
+	Day        string `gorm:"primaryKey"`
+	CategoryID int64  `gorm:"primaryKey;autoIncrement:false"`
+	Amount     decimal.Decimal
+}
+
+func (daily) TableName() string {
+	return "spendings_daily"
+}
+
+type auditRecord struct {
+	ID        int64
+	UserID    int64
+	Entity    string
+	EntityID  int64
+	Action    string
+	OldValue  string
+	NewValue  string
+	RevertsID int64
+	CreatedAt time.Time
+}
+
+func (auditRecord) TableName() string {
+	return "audit_log"
+}
+
+// deletion - обезличенная запись об удалении данных юзера
+type deletion struct {
+	ID         int64
+	Categories int64
+	Spendings  int64
+	CreatedAt  time.Time
+}
+
+func (deletion) TableName() string {
+	return "deletion_log"
+}
+
+// Формат дня в spendings_daily, совпадает с postgres_sql
+const dayLayout = "2006-01-02"
+
+// Open оборачивает открытое соединение с postgres в GORM
+func Open(db *sql.DB) (*gorm.DB, error) {
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "gorm open failed")
+	}
+	return gormDB, nil
+}
+
 type PostgresStorage struct {
 	db *gorm.DB
 }
@@ -19,117 +135,732 @@ func New(db *gorm.DB) *PostgresStorage {
 	}
 }
 
+func setErrorSpanAndReturnError(span opentracing.Span, err error) error {
+	ext.Error.Set(span, err != nil)
+	return err
+}
+
 // CreateSpending добавляет новую затрату в хранилище
-func (ps *PostgresStorage) CreateSpending(userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
-	category, inStor := ps.GetCategory(userID, categoryName)
-	if !inStor {
-		err := ps.CreateCategory(userID, categoryName)
+func (ps *PostgresStorage) CreateSpending(ctx context.Context,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateSpending")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		categoryID, err := getOrCreateCategory(tx, userID, categoryName)
 		if err != nil {
 			return err
 		}
-		category, _ = ps.GetCategory(userID, categoryName)
-	}
-	categoryID := category.ID
 
-	spend := repository.Spending{
+		// Строка лимита блокируется до конца транзакции: конкурентные траты юзера
+		// ждут коммита и считают сумму за месяц уже с учетом этой траты
+		var userLimit limit
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Take(&userLimit).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			now := time.Now()
+			currentYear, currentMonth, _ := now.Date()
+			firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, now.Location())
+
+			var summ decimal.Decimal
+			err = tx.Model(&spending{}).
+				Select("COALESCE(SUM(amount), 0)").
+				Where("user_id = ? AND (date BETWEEN ? AND ?)", userID, firstOfMonth, now).
+				Row().Scan(&summ)
+			if err != nil {
+				return err
+			}
+			if userLimit.Amount.LessThan(summ.Add(amount)) {
+				return repository.ErrLimitExceeded
+			}
+		}
+
+		return insertSpending(tx, userID, categoryID, categoryName, amount, date)
+	})
+
+	return setErrorSpanAndReturnError(span, err)
+}
+
+// insertSpending добавляет трату в существующую категорию без проверки лимита
+func insertSpending(tx *gorm.DB,
+	userID int64, categoryID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
+	newSpending := spending{
 		UserID:     userID,
-		CategoryId: int(categoryID),
+		CategoryID: categoryID,
 		Amount:     amount,
 		Date:       date,
 	}
-	result := ps.db.Create(&spend)
+	if err := tx.Create(&newSpending).Error; err != nil {
+		return err
+	}
+	if err := addDaily(tx, userID, categoryID, date, amount); err != nil {
+		return err
+	}
 
-	return result.Error
+	return writeAudit(tx, auditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditSpending,
+		EntityID: newSpending.ID,
+		Action:   repository.AuditCreate,
+		NewValue: repository.SpendingAuditValue(categoryName, amount, date),
+	})
+}
+
+// addDaily изменяет дневной агрегат трат на amount в транзакции изменения траты
+func addDaily(tx *gorm.DB, userID int64, categoryID int64, date time.Time, amount decimal.Decimal) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "day"}, {Name: "category_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"amount": gorm.Expr("spendings_daily.amount + EXCLUDED.amount"),
+		}),
+	}).Create(&daily{
+		UserID:     userID,
+		Day:        date.Format(dayLayout),
+		CategoryID: categoryID,
+		Amount:     amount,
+	}).Error
 }
 
-func (ps *PostgresStorage) GetCategory(userID int64, name string) (*repository.Category, bool) {
-	var cat repository.Category
-	result := ps.db.Where(&repository.Category{UserID: userID, Name: name}).First(&cat)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return nil, false
+func (ps *PostgresStorage) GetCategory(ctx context.Context,
+	userID int64, name string) (*repository.Category, bool, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetCategory")
+	defer span.Finish()
+
+	var cat category
+	err := ps.db.WithContext(ctx).
+		Where("user_id = ? AND name = ?", userID, name).
+		Take(&cat).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		return nil, false, setErrorSpanAndReturnError(span, err)
 	}
 
-	return &cat, true
+	return toRepositoryCategory(cat), true, nil
 }
 
 // CreateCategory создает новую категорию в хранилище
-func (ps *PostgresStorage) CreateCategory(userID int64, name string) error {
-	if _, inStor := ps.GetCategory(userID, name); inStor {
-		return repository.ErrCategoryExists
-	}
-	cat := repository.Category{
+func (ps *PostgresStorage) CreateCategory(ctx context.Context, userID int64, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateCategory")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := createCategory(tx, userID, name)
+		return err
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+// createCategory добавляет категорию; если такая уже есть, возвращает ErrCategoryExists
+
+func createCategory(tx *gorm.DB, userID int64, name string) (int64, error) {
+	newCat := category{
 		UserID: userID,
 		Name:   name,
 	}
-	result := ps.db.Create(&cat)
+	res := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}, {Name: "name"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&newCat)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, repository.ErrCategoryExists
+	}
 
-	return result.Error
+	return newCat.ID, writeAudit(tx, auditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditCategory,
+		EntityID: newCat.ID,
+		Action:   repository.AuditCreate,
+		NewValue: name,
+	})
+}
+
+// getOrCreateCategory возвращает id категории, создавая ее при отсутствии;
+// категорию, созданную конкурентной транзакцией, перечитывает после конфликта
+func getOrCreateCategory(tx *gorm.DB, userID int64, name string) (int64, error) {
+	var cat category
+	err := tx.Where("user_id = ? AND name = ?", userID, name).Take(&cat).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return cat.ID, err
+	}
+
+	cat.ID, err = createCategory(tx, userID, name)
+	if errors.Is(err, repository.ErrCategoryExists) {
+		err = tx.Where("user_id = ? AND name = ?", userID, name).Take(&cat).Error
+	}
+	return cat.ID, err
 }
 
 // GetAllCategories возвращает из хранилища все категории
-func (ps *PostgresStorage) GetAllCategories(userID int64) ([]*repository.Category, error) {
-	var cats []repository.Category
-	result := ps.db.Where(&repository.Category{UserID: userID}).Find(&cats)
-	var retCats []*repository.Category
+func (ps *PostgresStorage) GetAllCategories(ctx context.Context,
+	userID int64) ([]*repository.Category, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetAllCategories")
+	defer span.Finish()
+
+	var cats []category
+	err := ps.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("name").
+		Find(&cats).Error
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+
+	categories := make([]*repository.Category, 0, len(cats))
 	for _, cat := range cats {
-		retCats = append(retCats, &cat)
+		categories = append(categories, toRepositoryCategory(cat))
 	}
-	return retCats, result.Error
+
+	return categories, nil
 }
 
-// ReportPeriod возвращает отчет за период по каждой категории
-func (ps *PostgresStorage) ReportPeriod(userID int64, dateFirst time.Time, dateLast time.Time) ([]*repository.ReportByCategory, error) {
-	var spends []repository.Spending
-	result := ps.db.Where(&repository.Spending{UserID: userID}).Where("date BETWEEN ? AND ?", dateFirst, dateLast).Find(&spends)
-	if result.Error != nil {
-		return nil, result.Error
+func toRepositoryCategory(cat category) *repository.Category {
+	return &repository.Category{
+		ID:        cat.ID,
+		UserID:    cat.UserID,
+		Name:      cat.Name,
+		CreatedAt: cat.CreatedAt,
+		UpdatedAt: cat.UpdatedAt,
 	}
+}
 
-	reportMap := make(map[int64]decimal.Decimal)
-	for _, sp := range spends {
-		reportMap[int64(sp.CategoryId)] = reportMap[int64(sp.CategoryId)].Add(sp.Amount)
-	}
+// ReportPeriod возвращает отчет за период по каждой категории.
+// Полные дни периода читаются из дневных агрегатов spendings_daily,
+// неполные первый и последний день - из самих трат
+func (ps *PostgresStorage) ReportPeriod(ctx context.Context,
+	userID int64, dateFirst time.Time, dateLast time.Time) (*repository.Report, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ReportPeriod")
+	defer span.Finish()
+
+	dayFirst, dayLast := postgres_sql.FullDays(dateFirst, dateLast)
 
-	categories, err := ps.GetAllCategories(userID)
+	days := ps.db.
+		Table("spendings_daily d").
+		Select("d.day::timestamp AS date, d.amount, d.category_id").
+		Where("d.user_id = ? AND d.day >= ? AND d.day < ?",
+			userID, dayFirst.Format(dayLayout), dayLast.Format(dayLayout))
+	partialDays := ps.db.
+		Table("spendings sp").
+		Select("sp.date, sp.amount, sp.category_id").
+		Where("sp.user_id = ? AND sp.deleted_at IS NULL AND "+
+			"(sp.date BETWEEN ? AND ?) AND (sp.date < ? OR sp.date >= ?)",
+			userID, dateFirst, dateLast, dayFirst, dayLast)
+
+	var rows []struct {
+		MinDate      time.Time
+		Sum          decimal.Decimal
+		CategoryName string
+	}
+	err := ps.db.WithContext(ctx).
+		Table("(? UNION ALL ?) r", days, partialDays).
+		Select("MIN(r.date) AS min_date, SUM(r.amount) AS sum, cat.name AS category_name").
+		Joins("JOIN categories cat ON r.category_id = cat.id").
+		Group("cat.name").
+		Having("SUM(r.amount) > 0").
+		Order("cat.name").
+		Scan(&rows).Error
 	if err != nil {
-		return nil, err
+		return nil, setErrorSpanAndReturnError(span, err)
 	}
 
-	report := make([]*repository.ReportByCategory, 0, len(categories))
-	for _, cat := range categories {
-		if !reportMap[cat.ID].IsZero() {
-			report = append(report, &repository.ReportByCategory{
-				CategoryName: cat.Name,
-				Sum:          reportMap[cat.ID],
-			})
+	report := repository.Report{
+		ReportByCategory: make([]*repository.ReportByCategory, 0, len(rows)),
+		MinDate:          time.Now(),
+	}
+	for _, row := range rows {
+		report.ReportByCategory = append(report.ReportByCategory,
+			&repository.ReportByCategory{
+				CategoryName: row.CategoryName,
+				Sum:          row.Sum,
+			},
+		)
+		if row.MinDate.Before(report.MinDate) {
+			report.MinDate = row.MinDate
 		}
 	}
 
-	return report, nil
+	return &report, nil
 }
 
 // GetActiveCurrency возвращает используемую юзером валюту
-func (ps *PostgresStorage) GetActiveCurrency(userID int64) (curr string) {
-	var resp repository.Currency
-	result := ps.db.Model(repository.Currency{UserID: userID}).First(&resp)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return "RUB"
+func (ps *PostgresStorage) GetActiveCurrency(ctx context.Context, userID int64) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetActiveCurrency")
+	defer span.Finish()
+
+	curr := currency{
+		UserID:   userID,
+		CharCode: defaultCurrency,
+	}
+	// Валюта по умолчанию сохраняется при первом запросе
+	err := ps.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&curr).Error
+	if err != nil {
+		return "", setErrorSpanAndReturnError(span, err)
+	}
+
+	err = ps.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Take(&curr).Error
+	if err != nil {
+		return "", setErrorSpanAndReturnError(span, err)
 	}
-	return resp.CharCode
+
+	return curr.CharCode, nil
 }
 
 // SetActiveCurrency устанавливает используемую юзером валюту
-func (ps *PostgresStorage) SetActiveCurrency(userID int64, curr string) error {
-	var resp repository.Currency
-	result := ps.db.Model(repository.Currency{UserID: userID}).First(&resp)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		result = ps.db.Save(&repository.Currency{
+func (ps *PostgresStorage) SetActiveCurrency(ctx context.Context, userID int64, currCharCode string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "SetActiveCurrency")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setActiveCurrency(tx, userID, currCharCode, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setActiveCurrency(tx *gorm.DB, userID int64, currCharCode string, revertsID int64) error {
+	oldCurr := currency{CharCode: defaultCurrency}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		Take(&oldCurr).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"char_code", "updated_at"}),
+	}).
+		Create(&currency{
 			UserID:   userID,
-			CharCode: curr,
-		})
-	} else {
-		result = ps.db.Model(&repository.Currency{}).Where("user_id = ?", userID).Update("char_code", curr)
+			CharCode: currCharCode,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(tx, auditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditCurrency,
+		Action:    repository.AuditUpdate,
+		OldValue:  oldCurr.CharCode,
+		NewValue:  currCharCode,
+		RevertsID: revertsID,
+	})
+}
+
+// GetLimit возвращает лимит трат в месяц
+func (ps *PostgresStorage) GetLimit(ctx context.Context, userID int64) (decimal.Decimal, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetLimit")
+	defer span.Finish()
+
+	var userLimit limit
+	err := ps.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Take(&userLimit).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return userLimit.Amount, setErrorSpanAndReturnError(span, repository.ErrLimitNotSet)
+		}
+		return userLimit.Amount, setErrorSpanAndReturnError(span, err)
+	}
+
+	return userLimit.Amount, nil
+}
+
+// SetLimit устанавливает лимит трат в месяц
+func (ps *PostgresStorage) SetLimit(ctx context.Context, userID int64, amount decimal.Decimal) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "SetLimit")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setLimit(tx, userID, amount, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setLimit(tx *gorm.DB, userID int64, amount decimal.Decimal, revertsID int64) error {
+	record := auditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditCreate,
+		NewValue:  amount.String(),
+		RevertsID: revertsID,
+	}
+	var oldLimit limit
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		Take(&oldLimit).Error
+	switch {
+	case err == nil:
+		record.Action = repository.AuditUpdate
+		record.OldValue = oldLimit.Amount.String()
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "updated_at"}),
+	}).
+		Create(&limit{
+			UserID: userID,
+			Amount: amount,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(tx, record)
+}
+
+// DropLimit устанавливает неограниченный лимит трат в месяц
+func (ps *PostgresStorage) DropLimit(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "DropLimit")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dropLimit(tx, userID, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func dropLimit(tx *gorm.DB, userID int64, revertsID int64) error {
+	var oldLimits []limit
+	err := tx.Clauses(clause.Returning{}).
+		Where("user_id = ?", userID).
+		Delete(&oldLimits).Error
+	if err != nil || len(oldLimits) == 0 {
+		return err
+	}
+
+	return writeAudit(tx, auditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditDelete,
+		OldValue:  oldLimits[0].Amount.String(),
+		RevertsID: revertsID,
+	})
+}
+
+// GetHistory возвращает последние limit записей журнала изменений, новые первыми
+func (ps *PostgresStorage) GetHistory(ctx context.Context,
+	userID int64, limit int) ([]*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetHistory")
+	defer span.Finish()
+
+	var records []auditRecord
+	err := ps.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+
+	history := make([]*repository.AuditRecord, 0, len(records))
+	for _, record := range records {
+		history = append(history, toRepositoryAuditRecord(record))
+	}
+
+	return history, nil
+}
+
+// Undo отменяет последнее неотмененное изменение юзера, сделанное не раньше window назад,
+// и возвращает отмененную запись журнала
+func (ps *PostgresStorage) Undo(ctx context.Context,
+	userID int64, window time.Duration) (*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Undo")
+	defer span.Finish()
+
+	var record auditRecord
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// created_at пишет GORM временем приложения, поэтому и окно считается по нему
+		err := tx.
+			Where("user_id = ? AND reverts_id = 0 AND created_at >= ?", userID, time.Now().Add(-window)).
+			Where("NOT EXISTS (SELECT 1 FROM audit_log r WHERE r.reverts_id = audit_log.id)").
+			Order("id DESC").
+			Take(&record).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return repository.ErrNothingToUndo
+			}
+			return err
+		}
+
+		return revert(tx, record)
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return toRepositoryAuditRecord(record), nil
+}
+
+// revert записывает изменение, обратное record
+func revert(tx *gorm.DB, record auditRecord) error {
+	switch record.Entity {
+	case repository.AuditSpending:
+		var sp spending
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", record.EntityID).
+			Take(&sp).Error
+		switch {
+		case err == nil:
+			if err = tx.Delete(&sp).Error; err != nil {
+				return err
+			}
+			if err = addDaily(tx, sp.UserID, sp.CategoryID, sp.Date, sp.Amount.Neg()); err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+	case repository.AuditCategory:
+		if err := tx.Delete(&category{}, record.EntityID).Error; err != nil {
+			return err
+		}
+	case repository.AuditLimit:
+		if record.OldValue == "" {
+			return dropLimit(tx, record.UserID, record.ID)
+		}
+		oldLimit, err := decimal.NewFromString(record.OldValue)
+		if err != nil {
+			return err
+		}
+		return setLimit(tx, record.UserID, oldLimit, record.ID)
+	case repository.AuditCurrency:
+		return setActiveCurrency(tx, record.UserID, record.OldValue, record.ID)
+	default:
+		return errors.Errorf("unknown audit entity %q", record.Entity)
+	}
+
+	return writeAudit(tx, auditRecord{
+		UserID:    record.UserID,
+		Entity:    record.Entity,
+		EntityID:  record.EntityID,
+		Action:    repository.AuditDelete,
+		OldValue:  record.NewValue,
+		RevertsID: record.ID,
+	})
+}
+
+// ExportUserData возвращает все данные юзера для резервной копии
+func (ps *PostgresStorage) ExportUserData(ctx context.Context, userID int64) (*repository.UserData, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ExportUserData")
+	defer span.Finish()
+
+	data := &repository.UserData{Currency: defaultCurrency}
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&category{}).
+			Where("user_id = ?", userID).
+			Order("name").
+			Pluck("name", &data.Categories).Error
+		if err != nil {
+			return err
+		}
+
+		if data.Spendings, err = getAllSpendings(tx, userID); err != nil {
+			return err
+		}
+
+		var userLimit limit
+		err = tx.Where("user_id = ?", userID).Take(&userLimit).Error
+		switch {
+		case err == nil:
+			data.Limit = &userLimit.Amount
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		var curr currency
+		err = tx.Where("user_id = ?", userID).Take(&curr).Error
+		switch {
+		case err == nil:
+			data.Currency = curr.CharCode
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return data, nil
+}
+
+// getAllSpendings возвращает траты юзера, упорядоченные по дате
+func getAllSpendings(tx *gorm.DB, userID int64) ([]*repository.SpendingData, error) {
+	var spendings []*repository.SpendingData
+	err := tx.Model(&spending{}).
+		Select("categories.name AS category_name, spendings.amount, spendings.date").
+		Joins("JOIN categories ON categories.id = spendings.category_id").
+		Where("spendings.user_id = ?", userID).
+		Order("spendings.date, spendings.id").
+		Scan(&spendings).Error
+	return spendings, err
+}
+
+// ImportUserData добавляет юзеру данные из резервной копии, которых у него еще нет.
+// Лимит при загрузке трат не проверяется
+func (ps *PostgresStorage) ImportUserData(ctx context.Context,
+	userID int64, data *repository.UserData) (*repository.ImportResult, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ImportUserData")
+	defer span.Finish()
+
+	result := &repository.ImportResult{}
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Строка лимита блокирует параллельные траты юзера до конца загрузки
+		var userLimit limit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Take(&userLimit).Error
+		limitSet := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var categoriesBefore int64
+		if err = tx.Model(&category{}).Where("user_id = ?", userID).Count(&categoriesBefore).Error; err != nil {
+			return err
+		}
+
+		categoryIDs := make(map[string]int64)
+		getCategoryID := func(name string) (int64, error) {
+			if id, inMap := categoryIDs[name]; inMap {
+				return id, nil
+			}
+			id, err := getOrCreateCategory(tx, userID, name)
+			categoryIDs[name] = id
+			return id, err
+		}
+
+		for _, name := range data.Categories {
+			if _, err = getCategoryID(name); err != nil {
+				return err
+			}
+		}
+
+		existing, err := getAllSpendings(tx, userID)
+		if err != nil {
+			return err
+		}
+		missing := repository.MissingSpendings(existing, data.Spendings)
+		for _, sp := range missing {
+			categoryID, err := getCategoryID(sp.CategoryName)
+			if err != nil {
+				return err
+			}
+			if err = insertSpending(tx, userID, categoryID, sp.CategoryName, sp.Amount, sp.Date); err != nil {
+				return err
+			}
+		}
+		result.Spendings = len(missing)
+
+		var categoriesAfter int64
+		if err = tx.Model(&category{}).Where("user_id = ?", userID).Count(&categoriesAfter).Error; err != nil {
+			return err
+		}
+		result.Categories = int(categoriesAfter - categoriesBefore)
+
+		if data.Limit != nil && !(limitSet && userLimit.Amount.Equal(*data.Limit)) {
+			if err = setLimit(tx, userID, *data.Limit, 0); err != nil {
+				return err
+			}
+		}
+
+		if data.Currency != "" {
+			curr := currency{CharCode: defaultCurrency}
+			err = tx.Where("user_id = ?", userID).Take(&curr).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if curr.CharCode != data.Currency {
+				return setActiveCurrency(tx, userID, data.Currency, 0)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
 	}
+	return result, nil
+}
+
+// DeleteUserData удаляет все данные юзера вместе с журналом изменений
+// и записывает обезличенное событие удаления
+func (ps *PostgresStorage) DeleteUserData(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "DeleteUserData")
+	defer span.Finish()
+
+	err := ps.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Строка лимита блокирует параллельные траты юзера до конца удаления
+		var userLimits []limit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Find(&userLimits).Error
+		if err != nil {
+			return err
+		}
+
+		// Удаленные ранее траты и категории тоже стираются
+		var event deletion
+		result := tx.Unscoped().Where("user_id = ?", userID).Delete(&spending{})
+		if result.Error != nil {
+			return result.Error
+		}
+		event.Spendings = result.RowsAffected
+		result = tx.Unscoped().Where("user_id = ?", userID).Delete(&category{})
+		if result.Error != nil {
+			return result.Error
+		}
+		event.Categories = result.RowsAffected
+
+		for _, model := range []interface{}{&daily{}, &currency{}, &limit{}, &auditRecord{}} {
+			if err = tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&event).Error
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func toRepositoryAuditRecord(record auditRecord) *repository.AuditRecord {
+	return &repository.AuditRecord{
+		ID:        record.ID,
+		UserID:    record.UserID,
+		Entity:    record.Entity,
+		EntityID:  record.EntityID,
+		Action:    record.Action,
+		OldValue:  record.OldValue,
+		NewValue:  record.NewValue,
+		RevertsID: record.RevertsID,
+		CreatedAt: record.CreatedAt,
+	}
+}
 
-	return result.Error
+// writeAudit дописывает запись в журнал изменений в транзакции самого изменения
+func writeAudit(tx *gorm.DB, record auditRecord) error {
+	return tx.Create(&record).Error
 }
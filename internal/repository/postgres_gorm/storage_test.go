@@ -0,0 +1,44 @@
+package postgres_gorm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/cr00z/goSpendingBot/internal/migrate"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/storagertest"
+	"github.com/cr00z/goSpendingBot/migrations"
+	_ "github.com/lib/pq"
+)
+
+// Тест запускается на базе postgres, недостающие миграции применяются перед тестом:
+// TEST_POSTGRES_DSN="host=localhost port=5432 user=postgres password=qwerty sslmode=disable" go test ./...
+func TestPostgresStorage_Storager(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = migrate.New(db, migrate.DialectPostgres, migrations.Postgres).Up(context.Background(), &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gormDB, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storagertest.Run(t, func(t *testing.T) repository.Storager {
+		return New(gormDB)
+	})
+}
@@ -0,0 +1,71 @@
+package postgres_sql
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	benchSpendings  = 5_000
+	benchCategories = 10
+	benchDays       = 365
+)
+
+// Отчет по сырым тратам, как до появления spendings_daily
+const reportPeriodSpendingsQuery = `
+	SELECT MIN(sp.date), SUM(sp.amount), cat.name
+	FROM spendings sp, categories cat
+	WHERE sp.category_id = cat.id AND
+		  sp.user_id = $1 AND
+		  (sp.date BETWEEN $2 AND $3)
+	GROUP BY cat.name
+	HAVING SUM(sp.amount) > 0
+	ORDER BY cat.name;
+`
+
+// Годовой отчет юзера с длинной историей трат:
+// TEST_POSTGRES_DSN="..." go test -run=^$ -bench=ReportPeriod ./internal/repository/postgres_sql/
+func BenchmarkReportPeriod(b *testing.B) {
+	ctx := context.Background()
+	ps := New(openTestDB(b))
+
+	userID := time.Now().UnixNano()
+	for i := 0; i < benchSpendings; i++ {
+		category := "category" + strconv.Itoa(rand.Intn(benchCategories))
+		amount := decimal.NewFromFloat(float64(rand.Intn(1000)) / 100)
+		date := time.Now().AddDate(0, 0, -rand.Intn(benchDays))
+		if err := ps.CreateSpending(ctx, userID, category, amount, date); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	dateLast := time.Now()
+	dateFirst := dateLast.AddDate(-1, 0, 0)
+
+	b.Run("spendings", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := ps.db.QueryContext(ctx, reportPeriodSpendingsQuery, userID, dateFirst, dateLast)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = scanReport(rows)
+			rows.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("daily", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ps.ReportPeriod(ctx, userID, dateFirst, dateLast); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -36,6 +36,12 @@ func OpenAndConnect(envFile string) (*sql.DB, error) {
 	return db, nil
 }
 
+const defaultCurrency = "RUB"
+
+// Формат дня в spendings_daily. День берется по дате траты без учета часового пояса,
+// так же как дата хранится в колонке timestamp
+const dayLayout = "2006-01-02"
+
 type PostgresStorage struct {
 	db *sql.DB
 }
@@ -56,49 +62,27 @@ func (ps *PostgresStorage) CreateSpending(ctx context.Context,
 	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateSpending")
 	defer span.Finish()
 
-	category, inStor, err := ps.GetCategory(ctx, userID, categoryName)
+	tx, err := ps.db.BeginTx(ctx, nil)
 	if err != nil {
 		return setErrorSpanAndReturnError(span, err)
 	}
 
-	var categoryID int64
-
-	tx, err := ps.db.Begin()
+	categoryID, err := getOrCreateCategoryTx(ctx, tx, userID, categoryName)
 	if err != nil {
-		return setErrorSpanAndReturnError(span, err)
-	}
-
-	if inStor {
-		categoryID = category.ID
-	} else {
-		const query = `
-			INSERT INTO categories(
-				user_id,
-				name,
-				created_at,
-				updated_at
-			) VALUES (
-				$1, $2, now(), now()
-			) RETURNING id;
-		`
-		row := tx.QueryRowContext(ctx, query,
-			userID,
-			categoryName,
-		)
-		err := row.Scan(&categoryID)
-		if err != nil {
-			if tx.Rollback() != nil {
-				err = fmt.Errorf("%w, tx.Rollback() failed", err)
-			}
-			return setErrorSpanAndReturnError(span, err)
+		if tx.Rollback() != nil {
+			err = fmt.Errorf("%w, tx.Rollback() failed", err)
 		}
+		return setErrorSpanAndReturnError(span, err)
 	}
 
+	// Строка лимита блокируется до конца транзакции: конкурентные траты юзера
+	// ждут коммита и считают сумму за месяц уже с учетом этой траты
 	var unlimit bool
 	const query2 = `
 		SELECT amount
 		FROM limits
 		WHERE user_id = $1
+		FOR UPDATE
 	`
 	var limit decimal.Decimal
 	row := tx.QueryRowContext(ctx, query2, userID)
@@ -121,9 +105,10 @@ func (ps *PostgresStorage) CreateSpending(ctx context.Context,
 		firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
 
 		const query = `
-			SELECT SUM(sp.amount)
+			SELECT COALESCE(SUM(sp.amount), 0)
 			FROM spendings sp
 			WHERE sp.user_id = $1 AND
+				sp.deleted_at IS NULL AND
 				(sp.date BETWEEN $2 AND $3);
 		`
 		row := tx.QueryRowContext(ctx, query,
@@ -142,13 +127,29 @@ func (ps *PostgresStorage) CreateSpending(ctx context.Context,
 			}
 		}
 		if limit.LessThan(summ.Add(amount)) {
+			err = repository.ErrLimitExceeded
 			if tx.Rollback() != nil {
-				err = errors.Wrap(repository.ErrLimitExceeded, "tx.Rollback() failed")
+				err = fmt.Errorf("%w, tx.Rollback() failed", err)
 			}
 			return setErrorSpanAndReturnError(span, err)
 		}
 	}
 
+	err = insertSpendingTx(ctx, tx, userID, categoryID, categoryName, amount, date)
+	if err != nil {
+		if tx.Rollback() != nil {
+			err = fmt.Errorf("%w, tx.Rollback() failed", err)
+		}
+		return setErrorSpanAndReturnError(span, err)
+	}
+
+	return setErrorSpanAndReturnError(span, tx.Commit())
+}
+
+// insertSpendingTx добавляет трату в существующую категорию без проверки лимита
+func insertSpendingTx(ctx context.Context, tx *sql.Tx,
+	userID int64, categoryID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
 	const query = `
 		INSERT INTO spendings(
 			user_id,
@@ -159,22 +160,53 @@ func (ps *PostgresStorage) CreateSpending(ctx context.Context,
 			updated_at
 		) VALUES (
 			$1, $2, $3, $4, now(), now()
-		);
+		) RETURNING id;
 	`
-	_, err = tx.ExecContext(ctx, query,
+	var spendingID int64
+	row := tx.QueryRowContext(ctx, query,
 		userID,
 		categoryID,
 		amount,
 		date,
 	)
-	if err != nil {
-		if tx.Rollback() != nil {
-			err = fmt.Errorf("%w, tx.Rollback() failed", err)
-		}
-		return setErrorSpanAndReturnError(span, err)
+	if err := row.Scan(&spendingID); err != nil {
+		return err
+	}
+	if err := addDaily(ctx, tx, userID, categoryID, date, amount); err != nil {
+		return err
 	}
 
-	return setErrorSpanAndReturnError(span, tx.Commit())
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditSpending,
+		EntityID: spendingID,
+		Action:   repository.AuditCreate,
+		NewValue: repository.SpendingAuditValue(categoryName, amount, date),
+	})
+}
+
+// addDaily изменяет дневной агрегат трат на amount в транзакции изменения траты
+func addDaily(ctx context.Context, tx *sql.Tx,
+	userID int64, categoryID int64, date time.Time, amount decimal.Decimal) error {
+
+	const query = `
+		INSERT INTO spendings_daily(
+			user_id,
+			day,
+			category_id,
+			amount
+		) VALUES (
+			$1, $2, $3, $4
+		) ON CONFLICT (user_id, day, category_id) DO UPDATE
+			SET amount = spendings_daily.amount + EXCLUDED.amount;
+	`
+	_, err := tx.ExecContext(ctx, query,
+		userID,
+		date.Format(dayLayout),
+		categoryID,
+		amount,
+	)
+	return err
 }
 
 func (ps *PostgresStorage) GetCategory(ctx context.Context,
@@ -185,7 +217,7 @@ func (ps *PostgresStorage) GetCategory(ctx context.Context,
 
 	const query = `
 		SELECT id FROM categories
-		WHERE user_id = $1 AND name = $2;
+		WHERE user_id = $1 AND name = $2 AND deleted_at IS NULL;
 	`
 	var cat repository.Category
 	row := ps.db.QueryRowContext(ctx, query,
@@ -209,14 +241,16 @@ func (ps *PostgresStorage) CreateCategory(ctx context.Context,
 	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateCategory")
 	defer span.Finish()
 
-	_, inStor, err := ps.GetCategory(ctx, userID, name)
-	if err != nil {
-		return setErrorSpanAndReturnError(span, err)
-	}
-	if inStor {
-		return setErrorSpanAndReturnError(span, repository.ErrCategoryExists)
-	}
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := createCategoryTx(ctx, tx, userID, name)
+		return err
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
 
+// createCategoryTx создает категорию, уникальный индекс categories(user_id, name)
+// не дает создать ее дважды: тогда возвращается repository.ErrCategoryExists
+func createCategoryTx(ctx context.Context, tx *sql.Tx, userID int64, name string) (int64, error) {
 	const query = `
 		INSERT INTO categories(
 			user_id,
@@ -225,13 +259,48 @@ func (ps *PostgresStorage) CreateCategory(ctx context.Context,
 			updated_at
 		) VALUES (
 			$1, $2, now(), now()
-		);
+		) ON CONFLICT (user_id, name) WHERE deleted_at IS NULL DO NOTHING
+		RETURNING id;
 	`
-	_, err = ps.db.ExecContext(ctx, query,
+	var categoryID int64
+	row := tx.QueryRowContext(ctx, query,
 		userID,
 		name,
 	)
-	return setErrorSpanAndReturnError(span, err)
+	if err := row.Scan(&categoryID); err != nil {
+		if err == sql.ErrNoRows {
+			err = repository.ErrCategoryExists
+		}
+		return 0, err
+	}
+
+	return categoryID, writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditCategory,
+		EntityID: categoryID,
+		Action:   repository.AuditCreate,
+		NewValue: name,
+	})
+}
+
+// getOrCreateCategoryTx возвращает id категории, создавая ее при необходимости.
+// Если категорию одновременно создала параллельная трата, берется созданная ей
+func getOrCreateCategoryTx(ctx context.Context, tx *sql.Tx, userID int64, name string) (int64, error) {
+	const query = `
+		SELECT id FROM categories
+		WHERE user_id = $1 AND name = $2 AND deleted_at IS NULL;
+	`
+	var categoryID int64
+	err := tx.QueryRowContext(ctx, query, userID, name).Scan(&categoryID)
+	if err != sql.ErrNoRows {
+		return categoryID, err
+	}
+
+	categoryID, err = createCategoryTx(ctx, tx, userID, name)
+	if errors.Is(err, repository.ErrCategoryExists) {
+		err = tx.QueryRowContext(ctx, query, userID, name).Scan(&categoryID)
+	}
+	return categoryID, err
 }
 
 // GetAllCategories возвращает из хранилища все категории
@@ -244,7 +313,7 @@ func (ps *PostgresStorage) GetAllCategories(ctx context.Context,
 	const query = `
 		SELECT id, user_id, name, created_at, updated_at
 		FROM categories
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL
 		ORDER BY name;
 	`
 	rows, err := ps.db.QueryContext(ctx, query, userID)
@@ -272,7 +341,9 @@ func (ps *PostgresStorage) GetAllCategories(ctx context.Context,
 	return categories, nil
 }
 
-// ReportPeriod возвращает отчет за период по каждой категории
+// ReportPeriod возвращает отчет за период по каждой категории.
+// Полные дни периода читаются из дневных агрегатов spendings_daily,
+// неполные первый и последний день - из самих трат
 func (ps *PostgresStorage) ReportPeriod(ctx context.Context,
 	userID int64, dateFirst time.Time, dateLast time.Time) (*repository.Report, error) {
 
@@ -280,25 +351,60 @@ func (ps *PostgresStorage) ReportPeriod(ctx context.Context,
 	defer span.Finish()
 
 	const query = `
-		SELECT MIN(sp.date), SUM(sp.amount), cat.name
-		FROM spendings sp, categories cat
-		WHERE sp.category_id = cat.id AND
-		 	  sp.user_id = $1 AND
-		 	  (sp.date BETWEEN $2 AND $3)
+		SELECT MIN(r.date), SUM(r.amount), cat.name
+		FROM (
+			SELECT d.day::timestamp AS date, d.amount, d.category_id
+			FROM spendings_daily d
+			WHERE d.user_id = $1 AND
+				  d.day >= $4 AND d.day < $5
+			UNION ALL
+			SELECT sp.date, sp.amount, sp.category_id
+			FROM spendings sp
+			WHERE sp.user_id = $1 AND
+				  sp.deleted_at IS NULL AND
+				  (sp.date BETWEEN $2 AND $3) AND
+				  (sp.date < $6 OR sp.date >= $7)
+		) r, categories cat
+		WHERE r.category_id = cat.id
 		GROUP BY cat.name
-		HAVING SUM(sp.amount) > 0
+		HAVING SUM(r.amount) > 0
 		ORDER BY cat.name;
 	`
+	dayFirst, dayLast := FullDays(dateFirst, dateLast)
 	rows, err := ps.db.QueryContext(ctx, query,
 		userID,
 		dateFirst,
 		dateLast,
+		dayFirst.Format(dayLayout),
+		dayLast.Format(dayLayout),
+		dayFirst,
+		dayLast,
 	)
 	if err != nil {
 		return nil, setErrorSpanAndReturnError(span, err)
 	}
 	defer rows.Close()
 
+	report, err := scanReport(rows)
+	return report, setErrorSpanAndReturnError(span, err)
+}
+
+// FullDays возвращает границы полных дней периода: [dayFirst, dayLast).
+// Если полных дней нет, dayLast не позже dayFirst
+func FullDays(dateFirst time.Time, dateLast time.Time) (time.Time, time.Time) {
+	year, month, day := dateFirst.Date()
+	dayFirst := time.Date(year, month, day+1, 0, 0, 0, 0, dateFirst.Location())
+	if dayFirst.AddDate(0, 0, -1).Equal(dateFirst) {
+		dayFirst = dateFirst
+	}
+
+	year, month, day = dateLast.Date()
+	dayLast := time.Date(year, month, day, 0, 0, 0, 0, dateLast.Location())
+
+	return dayFirst, dayLast
+}
+
+func scanReport(rows *sql.Rows) (*repository.Report, error) {
 	report := repository.Report{
 		ReportByCategory: make([]*repository.ReportByCategory, 0),
 		MinDate:          time.Now(),
@@ -313,9 +419,8 @@ func (ps *PostgresStorage) ReportPeriod(ctx context.Context,
 			&name,
 		)
 		if err != nil {
-			return nil, setErrorSpanAndReturnError(span, err)
+			return nil, err
 		}
-		fmt.Println(minDate)
 		report.ReportByCategory = append(report.ReportByCategory,
 			&repository.ReportByCategory{
 				CategoryName: name,
@@ -327,7 +432,7 @@ func (ps *PostgresStorage) ReportPeriod(ctx context.Context,
 		}
 	}
 
-	return &report, nil
+	return &report, rows.Err()
 }
 
 // GetActiveCurrency возвращает используемую юзером валюту
@@ -361,13 +466,14 @@ func (ps *PostgresStorage) GetActiveCurrency(ctx context.Context,
 				created_at,
 				updated_at
 			) VALUES (
-				$1, 'RUB', now(), now());
+				$1, $2, now(), now());
 		`
 		_, err = tx.ExecContext(ctx, query,
 			userID,
+			defaultCurrency,
 		)
 		if err == nil {
-			return "RUB", setErrorSpanAndReturnError(span, tx.Commit())
+			return defaultCurrency, setErrorSpanAndReturnError(span, tx.Commit())
 		}
 	}
 	if tx.Rollback() != nil {
@@ -383,6 +489,21 @@ func (ps *PostgresStorage) SetActiveCurrency(ctx context.Context,
 	span, ctx := opentracing.StartSpanFromContext(ctx, "SetActiveCurrency")
 	defer span.Finish()
 
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		return setActiveCurrencyTx(ctx, tx, userID, currCharCode, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setActiveCurrencyTx(ctx context.Context, tx *sql.Tx,
+	userID int64, currCharCode string, revertsID int64) error {
+
+	oldCharCode := defaultCurrency
+	row := tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1 FOR UPDATE;`, userID)
+	if err := row.Scan(&oldCharCode); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
 	const query = `
 		INSERT INTO currencies(
 			user_id,
@@ -395,11 +516,22 @@ func (ps *PostgresStorage) SetActiveCurrency(ctx context.Context,
 			SET char_code = $2,
 				updated_at = now();
 	`
-	_, err := ps.db.ExecContext(ctx, query,
+	_, err := tx.ExecContext(ctx, query,
 		userID,
 		currCharCode,
 	)
-	return setErrorSpanAndReturnError(span, err)
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditCurrency,
+		Action:    repository.AuditUpdate,
+		OldValue:  oldCharCode,
+		NewValue:  currCharCode,
+		RevertsID: revertsID,
+	})
 }
 
 // GetLimit возвращает лимит трат в месяц
@@ -435,23 +567,54 @@ func (ps *PostgresStorage) SetLimit(ctx context.Context,
 	span, ctx := opentracing.StartSpanFromContext(ctx, "SetLimit")
 	defer span.Finish()
 
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		return setLimitTx(ctx, tx, userID, amount, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setLimitTx(ctx context.Context, tx *sql.Tx,
+	userID int64, amount decimal.Decimal, revertsID int64) error {
+
+	record := repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditCreate,
+		NewValue:  amount.String(),
+		RevertsID: revertsID,
+	}
+	var oldLimit decimal.Decimal
+	row := tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1 FOR UPDATE;`, userID)
+	err := row.Scan(&oldLimit)
+	switch {
+	case err == nil:
+		record.Action = repository.AuditUpdate
+		record.OldValue = oldLimit.String()
+	case err != sql.ErrNoRows:
+		return err
+	}
+
 	const query = `
-	INSERT INTO limits(
-		user_id,
-		amount,
-		created_at,
-		updated_at
-	) VALUES (
-		$1, $2, now(), now()
-	) ON CONFLICT (user_id) DO UPDATE
-		SET amount = $2,
-			updated_at = now();
+		INSERT INTO limits(
+			user_id,
+			amount,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, now(), now()
+		) ON CONFLICT (user_id) DO UPDATE
+			SET amount = $2,
+				updated_at = now();
 	`
-	_, err := ps.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		userID,
 		amount,
 	)
-	return setErrorSpanAndReturnError(span, err)
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(ctx, tx, record)
 }
 
 // DropLimit устанавливает неограниченный лимит трат в месяц
@@ -459,10 +622,452 @@ func (ps *PostgresStorage) DropLimit(ctx context.Context, userID int64) error {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "DropLimit")
 	defer span.Finish()
 
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		return dropLimitTx(ctx, tx, userID, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func dropLimitTx(ctx context.Context, tx *sql.Tx, userID int64, revertsID int64) error {
 	const query = `
 		DELETE FROM limits
-		WHERE user_id = $1;
+		WHERE user_id = $1
+		RETURNING amount;
+	`
+	var oldLimit decimal.Decimal
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&oldLimit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditDelete,
+		OldValue:  oldLimit.String(),
+		RevertsID: revertsID,
+	})
+}
+
+// GetHistory возвращает последние limit записей журнала изменений, новые первыми
+func (ps *PostgresStorage) GetHistory(ctx context.Context,
+	userID int64, limit int) ([]*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetHistory")
+	defer span.Finish()
+
+	const query = `
+		SELECT id, user_id, entity, entity_id, action, old_value, new_value, reverts_id, created_at
+		FROM audit_log
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2;
 	`
-	_, err := ps.db.ExecContext(ctx, query, userID)
+	rows, err := ps.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	defer rows.Close()
+
+	var history []*repository.AuditRecord
+	for rows.Next() {
+		var record repository.AuditRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.UserID,
+			&record.Entity,
+			&record.EntityID,
+			&record.Action,
+			&record.OldValue,
+			&record.NewValue,
+			&record.RevertsID,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, setErrorSpanAndReturnError(span, err)
+		}
+		history = append(history, &record)
+	}
+
+	return history, setErrorSpanAndReturnError(span, rows.Err())
+}
+
+// Undo отменяет последнее неотмененное изменение юзера, сделанное не раньше window назад,
+// и возвращает отмененную запись журнала
+func (ps *PostgresStorage) Undo(ctx context.Context,
+	userID int64, window time.Duration) (*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Undo")
+	defer span.Finish()
+
+	var record repository.AuditRecord
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		// Окно считается в базе, created_at пишется через now()
+		const query = `
+			SELECT id, user_id, entity, entity_id, action, old_value, new_value, reverts_id, created_at,
+				created_at >= now() - make_interval(secs => $2)
+			FROM audit_log a
+			WHERE user_id = $1
+				AND reverts_id = 0
+				AND NOT EXISTS (SELECT 1 FROM audit_log r WHERE r.reverts_id = a.id)
+			ORDER BY id DESC
+			LIMIT 1;
+		`
+		var inWindow bool
+		err := tx.QueryRowContext(ctx, query, userID, window.Seconds()).Scan(
+			&record.ID,
+			&record.UserID,
+			&record.Entity,
+			&record.EntityID,
+			&record.Action,
+			&record.OldValue,
+			&record.NewValue,
+			&record.RevertsID,
+			&record.CreatedAt,
+			&inWindow,
+		)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return repository.ErrNothingToUndo
+			}
+			return err
+		}
+		if !inWindow {
+			return repository.ErrNothingToUndo
+		}
+
+		return revertTx(ctx, tx, record)
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return &record, nil
+}
+
+// revertTx записывает изменение, обратное record
+func revertTx(ctx context.Context, tx *sql.Tx, record repository.AuditRecord) error {
+	switch record.Entity {
+	case repository.AuditSpending:
+		const query = `
+			UPDATE spendings
+			SET deleted_at = now(),
+				updated_at = now()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING category_id, date, amount;
+		`
+		var categoryID int64
+		var date time.Time
+		var amount decimal.Decimal
+		err := tx.QueryRowContext(ctx, query, record.EntityID).Scan(&categoryID, &date, &amount)
+		switch {
+		case err == nil:
+			err = addDaily(ctx, tx, record.UserID, categoryID, date, amount.Neg())
+			if err != nil {
+				return err
+			}
+		case err != sql.ErrNoRows:
+			return err
+		}
+	case repository.AuditCategory:
+		const query = `
+			UPDATE categories
+			SET deleted_at = now(),
+				updated_at = now()
+			WHERE id = $1 AND deleted_at IS NULL;
+		`
+		if _, err := tx.ExecContext(ctx, query, record.EntityID); err != nil {
+			return err
+		}
+	case repository.AuditLimit:
+		if record.OldValue == "" {
+			return dropLimitTx(ctx, tx, record.UserID, record.ID)
+		}
+		oldLimit, err := decimal.NewFromString(record.OldValue)
+		if err != nil {
+			return err
+		}
+		return setLimitTx(ctx, tx, record.UserID, oldLimit, record.ID)
+	case repository.AuditCurrency:
+		return setActiveCurrencyTx(ctx, tx, record.UserID, record.OldValue, record.ID)
+	default:
+		return fmt.Errorf("unknown audit entity %q", record.Entity)
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    record.UserID,
+		Entity:    record.Entity,
+		EntityID:  record.EntityID,
+		Action:    repository.AuditDelete,
+		OldValue:  record.NewValue,
+		RevertsID: record.ID,
+	})
+}
+
+// ExportUserData возвращает все данные юзера для резервной копии
+func (ps *PostgresStorage) ExportUserData(ctx context.Context, userID int64) (*repository.UserData, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ExportUserData")
+	defer span.Finish()
+
+	data := &repository.UserData{Currency: defaultCurrency}
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		const query = `
+			SELECT name
+			FROM categories
+			WHERE user_id = $1 AND deleted_at IS NULL
+			ORDER BY name;
+		`
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				return err
+			}
+			data.Categories = append(data.Categories, name)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if data.Spendings, err = getAllSpendingsTx(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		var limit decimal.Decimal
+		err = tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID).Scan(&limit)
+		switch {
+		case err == nil:
+			data.Limit = &limit
+		case err != sql.ErrNoRows:
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID).
+			Scan(&data.Currency)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return data, nil
+}
+
+// getAllSpendingsTx возвращает траты юзера, упорядоченные по дате
+func getAllSpendingsTx(ctx context.Context, tx *sql.Tx, userID int64) ([]*repository.SpendingData, error) {
+	const query = `
+		SELECT c.name, s.amount, s.date
+		FROM spendings s
+		JOIN categories c ON c.id = s.category_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL
+		ORDER BY s.date, s.id;
+	`
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spendings []*repository.SpendingData
+	for rows.Next() {
+		var sp repository.SpendingData
+		if err = rows.Scan(&sp.CategoryName, &sp.Amount, &sp.Date); err != nil {
+			return nil, err
+		}
+		spendings = append(spendings, &sp)
+	}
+	return spendings, rows.Err()
+}
+
+// ImportUserData добавляет юзеру данные из резервной копии, которых у него еще нет.
+// Лимит при загрузке трат не проверяется
+func (ps *PostgresStorage) ImportUserData(ctx context.Context,
+	userID int64, data *repository.UserData) (*repository.ImportResult, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ImportUserData")
+	defer span.Finish()
+
+	result := &repository.ImportResult{}
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		// Строка лимита блокирует параллельные траты юзера до конца загрузки
+		var limit decimal.Decimal
+		err := tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1 FOR UPDATE;`, userID).
+			Scan(&limit)
+		limitSet := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		categoriesBefore, err := countCategoriesTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		categoryIDs := make(map[string]int64)
+		getCategoryID := func(name string) (int64, error) {
+			if id, inMap := categoryIDs[name]; inMap {
+				return id, nil
+			}
+			id, err := getOrCreateCategoryTx(ctx, tx, userID, name)
+			categoryIDs[name] = id
+			return id, err
+		}
+
+		for _, name := range data.Categories {
+			if _, err = getCategoryID(name); err != nil {
+				return err
+			}
+		}
+
+		existing, err := getAllSpendingsTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		missing := repository.MissingSpendings(existing, data.Spendings)
+		for _, sp := range missing {
+			categoryID, err := getCategoryID(sp.CategoryName)
+			if err != nil {
+				return err
+			}
+			err = insertSpendingTx(ctx, tx, userID, categoryID, sp.CategoryName, sp.Amount, sp.Date)
+			if err != nil {
+				return err
+			}
+		}
+		result.Spendings = len(missing)
+
+		categoriesAfter, err := countCategoriesTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		result.Categories = categoriesAfter - categoriesBefore
+
+		if data.Limit != nil && !(limitSet && limit.Equal(*data.Limit)) {
+			if err = setLimitTx(ctx, tx, userID, *data.Limit, 0); err != nil {
+				return err
+			}
+		}
+
+		if data.Currency != "" {
+			curr := defaultCurrency
+			err = tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID).
+				Scan(&curr)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if curr != data.Currency {
+				return setActiveCurrencyTx(ctx, tx, userID, data.Currency, 0)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return result, nil
+}
+
+// Количество категорий юзера
+func countCategoriesTx(ctx context.Context, tx *sql.Tx, userID int64) (int, error) {
+	const query = `SELECT COUNT(*) FROM categories WHERE user_id = $1 AND deleted_at IS NULL;`
+	var count int
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// DeleteUserData удаляет все данные юзера вместе с журналом изменений
+// и записывает обезличенное событие удаления
+func (ps *PostgresStorage) DeleteUserData(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "DeleteUserData")
+	defer span.Finish()
+
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		// Строка лимита блокирует параллельные траты юзера до конца удаления
+		_, err := tx.ExecContext(ctx, `SELECT 1 FROM limits WHERE user_id = $1 FOR UPDATE;`, userID)
+		if err != nil {
+			return err
+		}
+
+		var counts [2]int64
+		for i, table := range []string{"spendings", "categories"} {
+			result, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1;`, userID)
+			if err != nil {
+				return err
+			}
+			if counts[i], err = result.RowsAffected(); err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"spendings_daily", "currencies", "limits", "audit_log"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1;`, userID); err != nil {
+				return err
+			}
+		}
+
+		const query = `
+			INSERT INTO deletion_log(
+				categories,
+				spendings,
+				created_at
+			) VALUES (
+				$1, $2, now()
+			);
+		`
+		_, err = tx.ExecContext(ctx, query, counts[1], counts[0])
+		return err
+	})
 	return setErrorSpanAndReturnError(span, err)
 }
+
+// inTx выполняет fn в транзакции и откатывает ее при ошибке
+func (ps *PostgresStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		if tx.Rollback() != nil {
+			err = fmt.Errorf("%w, tx.Rollback() failed", err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// writeAudit дописывает запись в журнал изменений в транзакции самого изменения
+func writeAudit(ctx context.Context, tx *sql.Tx, record repository.AuditRecord) error {
+	const query = `
+		INSERT INTO audit_log(
+			user_id,
+			entity,
+			entity_id,
+			action,
+			old_value,
+			new_value,
+			reverts_id,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, now()
+		);
+	`
+	_, err := tx.ExecContext(ctx, query,
+		record.UserID,
+		record.Entity,
+		record.EntityID,
+		record.Action,
+		record.OldValue,
+		record.NewValue,
+		record.RevertsID,
+	)
+	return err
+}
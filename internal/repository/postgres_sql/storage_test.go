@@ -0,0 +1,71 @@
+package postgres_sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/migrate"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/storagertest"
+	"github.com/cr00z/goSpendingBot/migrations"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// Тест запускается на базе postgres, недостающие миграции применяются перед тестом:
+// TEST_POSTGRES_DSN="host=localhost port=5432 user=postgres password=qwerty sslmode=disable" go test ./...
+func openTestDB(tb testing.TB) *sql.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		tb.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	err = migrate.New(db, migrate.DialectPostgres, migrations.Postgres).Up(context.Background(), &bytes.Buffer{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func TestPostgresStorage_Storager(t *testing.T) {
+	db := openTestDB(t)
+
+	storagertest.Run(t, func(t *testing.T) repository.Storager {
+		return New(db)
+	})
+}
+
+func TestFullDays(t *testing.T) {
+	day := func(d, h int) time.Time {
+		return time.Date(2022, time.November, d, h, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name      string
+		dateFirst time.Time
+		dateLast  time.Time
+		dayFirst  time.Time
+		dayLast   time.Time
+	}{
+		{"partial boundaries", day(10, 12), day(17, 12), day(11, 0), day(17, 0)},
+		{"first at midnight", day(10, 0), day(17, 12), day(10, 0), day(17, 0)},
+		{"same day", day(10, 9), day(10, 18), day(11, 0), day(10, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dayFirst, dayLast := FullDays(tt.dateFirst, tt.dateLast)
+
+			assert.Equal(t, tt.dayFirst, dayFirst)
+			assert.Equal(t, tt.dayLast, dayLast)
+		})
+	}
+}
@@ -0,0 +1,944 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/postgres_sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const defaultCurrency = "RUB"
+
+// Суммы хранятся целыми числами с точностью decimal(20, 8)
+const amountExp = 8
+
+// OpenAndConnect открывает файл базы, миграции применяются пакетом migrate
+func OpenAndConnect(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, errors.Wrap(err, "db open failed")
+	}
+	// Запись в sqlite однопоточная, одно соединение исключает SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		return nil, errors.Wrap(err, "db connect failed")
+	}
+	return db, nil
+}
+
+type SqliteStorage struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *SqliteStorage {
+	return &SqliteStorage{db}
+}
+
+func setErrorSpanAndReturnError(span opentracing.Span, err error) error {
+	ext.Error.Set(span, err != nil)
+	return err
+}
+
+func toUnits(amount decimal.Decimal) int64 {
+	return amount.Shift(amountExp).IntPart()
+}
+
+func fromUnits(units int64) decimal.Decimal {
+	return decimal.New(units, -amountExp)
+}
+
+func toTime(date time.Time) int64 {
+	return date.UnixNano()
+}
+
+// День в spendings_daily - начало суток даты траты в ее часовом поясе
+func toDay(date time.Time) int64 {
+	year, month, day := date.Date()
+	return toTime(time.Date(year, month, day, 0, 0, 0, 0, date.Location()))
+}
+
+func fromTime(nsec int64) time.Time {
+	return time.Unix(0, nsec)
+}
+
+// CreateSpending добавляет новую затрату в хранилище
+func (ss *SqliteStorage) CreateSpending(ctx context.Context,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateSpending")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		return createSpendingTx(ctx, tx, userID, categoryName, amount, date)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func createSpendingTx(ctx context.Context, tx *sql.Tx,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
+	now := time.Now()
+
+	var limit sql.NullInt64
+	row := tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID)
+	if err := row.Scan(&limit); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if limit.Valid {
+		currentYear, currentMonth, _ := now.Date()
+		firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, now.Location())
+
+		const query = `
+			SELECT COALESCE(SUM(amount), 0)
+			FROM spendings
+			WHERE user_id = $1 AND
+				deleted_at IS NULL AND
+				(date BETWEEN $2 AND $3);
+		`
+		var summ int64
+		row := tx.QueryRowContext(ctx, query, userID, toTime(firstOfMonth), toTime(now))
+		if err := row.Scan(&summ); err != nil {
+			return err
+		}
+		if fromUnits(limit.Int64).LessThan(fromUnits(summ).Add(amount)) {
+			return repository.ErrLimitExceeded
+		}
+	}
+
+	return insertSpendingTx(ctx, tx, userID, categoryName, amount, date)
+}
+
+// insertSpendingTx добавляет трату без проверки лимита, категория создается при необходимости
+func insertSpendingTx(ctx context.Context, tx *sql.Tx,
+	userID int64, categoryName string, amount decimal.Decimal, date time.Time) error {
+
+	categoryID, err := getCategoryID(ctx, tx, userID, categoryName)
+	if err == sql.ErrNoRows {
+		categoryID, err = createCategoryTx(ctx, tx, userID, categoryName)
+	}
+	if err != nil {
+		return err
+	}
+
+	const query = `
+		INSERT INTO spendings(
+			user_id,
+			category_id,
+			amount,
+			date,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $5
+		);
+	`
+	result, err := tx.ExecContext(ctx, query,
+		userID,
+		categoryID,
+		toUnits(amount),
+		toTime(date),
+		toTime(time.Now()),
+	)
+	if err != nil {
+		return err
+	}
+	spendingID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err = addDaily(ctx, tx, userID, categoryID, date, amount); err != nil {
+		return err
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditSpending,
+		EntityID: spendingID,
+		Action:   repository.AuditCreate,
+		NewValue: repository.SpendingAuditValue(categoryName, amount, date),
+	})
+}
+
+// addDaily изменяет дневной агрегат трат на amount в транзакции изменения траты
+func addDaily(ctx context.Context, tx *sql.Tx,
+	userID int64, categoryID int64, date time.Time, amount decimal.Decimal) error {
+
+	const query = `
+		INSERT INTO spendings_daily(
+			user_id,
+			day,
+			category_id,
+			amount
+		) VALUES (
+			$1, $2, $3, $4
+		) ON CONFLICT (user_id, day, category_id) DO UPDATE
+			SET amount = spendings_daily.amount + excluded.amount;
+	`
+	_, err := tx.ExecContext(ctx, query,
+		userID,
+		toDay(date),
+		categoryID,
+		toUnits(amount),
+	)
+	return err
+}
+
+func getCategoryID(ctx context.Context, tx *sql.Tx, userID int64, name string) (int64, error) {
+	const query = `
+		SELECT id FROM categories
+		WHERE user_id = $1 AND name = $2 AND deleted_at IS NULL;
+	`
+	var categoryID int64
+	err := tx.QueryRowContext(ctx, query, userID, name).Scan(&categoryID)
+	return categoryID, err
+}
+
+func createCategoryTx(ctx context.Context, tx *sql.Tx, userID int64, name string) (int64, error) {
+	const query = `
+		INSERT INTO categories(
+			user_id,
+			name,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $3
+		);
+	`
+	result, err := tx.ExecContext(ctx, query, userID, name, toTime(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	categoryID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:   userID,
+		Entity:   repository.AuditCategory,
+		EntityID: categoryID,
+		Action:   repository.AuditCreate,
+		NewValue: name,
+	})
+	return categoryID, err
+}
+
+// CreateCategory создает новую категорию в хранилище
+func (ss *SqliteStorage) CreateCategory(ctx context.Context, userID int64, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateCategory")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := getCategoryID(ctx, tx, userID, name)
+		if err == nil {
+			return repository.ErrCategoryExists
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err = createCategoryTx(ctx, tx, userID, name)
+		return err
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+// GetAllCategories возвращает из хранилища все категории
+func (ss *SqliteStorage) GetAllCategories(ctx context.Context,
+	userID int64) ([]*repository.Category, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetAllCategories")
+	defer span.Finish()
+
+	const query = `
+		SELECT id, user_id, name, created_at, updated_at
+		FROM categories
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY name;
+	`
+	rows, err := ss.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	defer rows.Close()
+
+	var categories []*repository.Category
+	for rows.Next() {
+		var cat repository.Category
+		var createdAt, updatedAt int64
+		err := rows.Scan(
+			&cat.ID,
+			&cat.UserID,
+			&cat.Name,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, setErrorSpanAndReturnError(span, err)
+		}
+		cat.CreatedAt = fromTime(createdAt)
+		cat.UpdatedAt = fromTime(updatedAt)
+		categories = append(categories, &cat)
+	}
+
+	return categories, setErrorSpanAndReturnError(span, rows.Err())
+}
+
+// ReportPeriod возвращает отчет за период по каждой категории.
+// Полные дни периода читаются из дневных агрегатов spendings_daily,
+// неполные первый и последний день - из самих трат
+func (ss *SqliteStorage) ReportPeriod(ctx context.Context,
+	userID int64, dateFirst time.Time, dateLast time.Time) (*repository.Report, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ReportPeriod")
+	defer span.Finish()
+
+	// sqlite нумерует параметры $N в порядке их первого появления в запросе
+	const query = `
+		SELECT MIN(r.date), SUM(r.amount), cat.name
+		FROM (
+			SELECT d.day AS date, d.amount, d.category_id
+			FROM spendings_daily d
+			WHERE d.user_id = $1 AND
+				  d.day >= $2 AND d.day < $3
+			UNION ALL
+			SELECT sp.date, sp.amount, sp.category_id
+			FROM spendings sp
+			WHERE sp.user_id = $1 AND
+				  sp.deleted_at IS NULL AND
+				  (sp.date BETWEEN $4 AND $5) AND
+				  (sp.date < $2 OR sp.date >= $3)
+		) r, categories cat
+		WHERE r.category_id = cat.id
+		GROUP BY cat.name
+		HAVING SUM(r.amount) > 0
+		ORDER BY cat.name;
+	`
+	dayFirst, dayLast := postgres_sql.FullDays(dateFirst, dateLast)
+	rows, err := ss.db.QueryContext(ctx, query,
+		userID,
+		toTime(dayFirst),
+		toTime(dayLast),
+		toTime(dateFirst),
+		toTime(dateLast),
+	)
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	defer rows.Close()
+
+	report := repository.Report{
+		ReportByCategory: make([]*repository.ReportByCategory, 0),
+		MinDate:          time.Now(),
+	}
+	for rows.Next() {
+		var amount, minDate int64
+		var name string
+		err := rows.Scan(
+			&minDate,
+			&amount,
+			&name,
+		)
+		if err != nil {
+			return nil, setErrorSpanAndReturnError(span, err)
+		}
+		report.ReportByCategory = append(report.ReportByCategory,
+			&repository.ReportByCategory{
+				CategoryName: name,
+				Sum:          fromUnits(amount),
+			},
+		)
+		if date := fromTime(minDate); date.Before(report.MinDate) {
+			report.MinDate = date
+		}
+	}
+
+	return &report, setErrorSpanAndReturnError(span, rows.Err())
+}
+
+// GetActiveCurrency возвращает используемую юзером валюту
+func (ss *SqliteStorage) GetActiveCurrency(ctx context.Context, userID int64) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetActiveCurrency")
+	defer span.Finish()
+
+	// Валюта по умолчанию сохраняется при первом запросе
+	const query = `
+		INSERT INTO currencies(
+			user_id,
+			char_code,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $3
+		) ON CONFLICT (user_id) DO NOTHING;
+	`
+	_, err := ss.db.ExecContext(ctx, query, userID, defaultCurrency, toTime(time.Now()))
+	if err != nil {
+		return "", setErrorSpanAndReturnError(span, err)
+	}
+
+	var currCharCode string
+	row := ss.db.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID)
+	err = row.Scan(&currCharCode)
+	return currCharCode, setErrorSpanAndReturnError(span, err)
+}
+
+// SetActiveCurrency устанавливает используемую юзером валюту
+func (ss *SqliteStorage) SetActiveCurrency(ctx context.Context, userID int64, currCharCode string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "SetActiveCurrency")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		return setActiveCurrencyTx(ctx, tx, userID, currCharCode, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setActiveCurrencyTx(ctx context.Context, tx *sql.Tx, userID int64, currCharCode string, revertsID int64) error {
+	oldCharCode := defaultCurrency
+	row := tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID)
+	if err := row.Scan(&oldCharCode); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	const query = `
+		INSERT INTO currencies(
+			user_id,
+			char_code,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $3
+		) ON CONFLICT (user_id) DO UPDATE
+			SET char_code = $2,
+				updated_at = $3;
+	`
+	_, err := tx.ExecContext(ctx, query, userID, currCharCode, toTime(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditCurrency,
+		Action:    repository.AuditUpdate,
+		OldValue:  oldCharCode,
+		NewValue:  currCharCode,
+		RevertsID: revertsID,
+	})
+}
+
+// GetLimit возвращает лимит трат в месяц
+func (ss *SqliteStorage) GetLimit(ctx context.Context, userID int64) (decimal.Decimal, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetLimit")
+	defer span.Finish()
+
+	var limit int64
+	row := ss.db.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID)
+	err := row.Scan(&limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return decimal.Decimal{}, setErrorSpanAndReturnError(span, repository.ErrLimitNotSet)
+		}
+		return decimal.Decimal{}, setErrorSpanAndReturnError(span, err)
+	}
+
+	return fromUnits(limit), nil
+}
+
+// SetLimit устанавливает лимит трат в месяц
+func (ss *SqliteStorage) SetLimit(ctx context.Context, userID int64, amount decimal.Decimal) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "SetLimit")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		return setLimitTx(ctx, tx, userID, amount, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func setLimitTx(ctx context.Context, tx *sql.Tx, userID int64, amount decimal.Decimal, revertsID int64) error {
+	record := repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditCreate,
+		NewValue:  amount.String(),
+		RevertsID: revertsID,
+	}
+	var oldLimit int64
+	err := tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID).Scan(&oldLimit)
+	switch {
+	case err == nil:
+		record.Action = repository.AuditUpdate
+		record.OldValue = fromUnits(oldLimit).String()
+	case err != sql.ErrNoRows:
+		return err
+	}
+
+	const query = `
+		INSERT INTO limits(
+			user_id,
+			amount,
+			created_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $3
+		) ON CONFLICT (user_id) DO UPDATE
+			SET amount = $2,
+				updated_at = $3;
+	`
+	_, err = tx.ExecContext(ctx, query, userID, toUnits(amount), toTime(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	return writeAudit(ctx, tx, record)
+}
+
+// DropLimit устанавливает неограниченный лимит трат в месяц
+func (ss *SqliteStorage) DropLimit(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "DropLimit")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		return dropLimitTx(ctx, tx, userID, 0)
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+func dropLimitTx(ctx context.Context, tx *sql.Tx, userID int64, revertsID int64) error {
+	var oldLimit int64
+	err := tx.QueryRowContext(ctx, `DELETE FROM limits WHERE user_id = $1 RETURNING amount;`, userID).
+		Scan(&oldLimit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    userID,
+		Entity:    repository.AuditLimit,
+		Action:    repository.AuditDelete,
+		OldValue:  fromUnits(oldLimit).String(),
+		RevertsID: revertsID,
+	})
+}
+
+// GetHistory возвращает последние limit записей журнала изменений, новые первыми
+func (ss *SqliteStorage) GetHistory(ctx context.Context,
+	userID int64, limit int) ([]*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetHistory")
+	defer span.Finish()
+
+	const query = `
+		SELECT id, user_id, entity, entity_id, action, old_value, new_value, reverts_id, created_at
+		FROM audit_log
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2;
+	`
+	rows, err := ss.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	defer rows.Close()
+
+	var history []*repository.AuditRecord
+	for rows.Next() {
+		var record repository.AuditRecord
+		var createdAt int64
+		err := rows.Scan(
+			&record.ID,
+			&record.UserID,
+			&record.Entity,
+			&record.EntityID,
+			&record.Action,
+			&record.OldValue,
+			&record.NewValue,
+			&record.RevertsID,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, setErrorSpanAndReturnError(span, err)
+		}
+		record.CreatedAt = fromTime(createdAt)
+		history = append(history, &record)
+	}
+
+	return history, setErrorSpanAndReturnError(span, rows.Err())
+}
+
+// Undo отменяет последнее неотмененное изменение юзера, сделанное не раньше window назад,
+// и возвращает отмененную запись журнала
+func (ss *SqliteStorage) Undo(ctx context.Context,
+	userID int64, window time.Duration) (*repository.AuditRecord, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Undo")
+	defer span.Finish()
+
+	var record repository.AuditRecord
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		const query = `
+			SELECT id, user_id, entity, entity_id, action, old_value, new_value, reverts_id, created_at
+			FROM audit_log a
+			WHERE user_id = $1
+				AND reverts_id = 0
+				AND NOT EXISTS (SELECT 1 FROM audit_log r WHERE r.reverts_id = a.id)
+			ORDER BY id DESC
+			LIMIT 1;
+		`
+		var createdAt int64
+		err := tx.QueryRowContext(ctx, query, userID).Scan(
+			&record.ID,
+			&record.UserID,
+			&record.Entity,
+			&record.EntityID,
+			&record.Action,
+			&record.OldValue,
+			&record.NewValue,
+			&record.RevertsID,
+			&createdAt,
+		)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return repository.ErrNothingToUndo
+			}
+			return err
+		}
+		record.CreatedAt = fromTime(createdAt)
+		if record.CreatedAt.Before(time.Now().Add(-window)) {
+			return repository.ErrNothingToUndo
+		}
+
+		return revertTx(ctx, tx, record)
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return &record, nil
+}
+
+// revertTx записывает изменение, обратное record
+func revertTx(ctx context.Context, tx *sql.Tx, record repository.AuditRecord) error {
+	now := toTime(time.Now())
+	var table string
+	switch record.Entity {
+	case repository.AuditSpending:
+		const query = `
+			UPDATE spendings
+			SET deleted_at = $1,
+				updated_at = $1
+			WHERE id = $2 AND deleted_at IS NULL
+			RETURNING category_id, date, amount;
+		`
+		var categoryID, date, amount int64
+		err := tx.QueryRowContext(ctx, query, now, record.EntityID).Scan(&categoryID, &date, &amount)
+		switch {
+		case err == nil:
+			err = addDaily(ctx, tx, record.UserID, categoryID, fromTime(date), fromUnits(amount).Neg())
+			if err != nil {
+				return err
+			}
+		case err != sql.ErrNoRows:
+			return err
+		}
+	case repository.AuditCategory:
+		table = "categories"
+	case repository.AuditLimit:
+		if record.OldValue == "" {
+			return dropLimitTx(ctx, tx, record.UserID, record.ID)
+		}
+		oldLimit, err := decimal.NewFromString(record.OldValue)
+		if err != nil {
+			return err
+		}
+		return setLimitTx(ctx, tx, record.UserID, oldLimit, record.ID)
+	case repository.AuditCurrency:
+		return setActiveCurrencyTx(ctx, tx, record.UserID, record.OldValue, record.ID)
+	default:
+		return fmt.Errorf("unknown audit entity %q", record.Entity)
+	}
+
+	if table != "" {
+		query := `UPDATE ` + table + ` SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL;`
+		if _, err := tx.ExecContext(ctx, query, now, record.EntityID); err != nil {
+			return err
+		}
+	}
+
+	return writeAudit(ctx, tx, repository.AuditRecord{
+		UserID:    record.UserID,
+		Entity:    record.Entity,
+		EntityID:  record.EntityID,
+		Action:    repository.AuditDelete,
+		OldValue:  record.NewValue,
+		RevertsID: record.ID,
+	})
+}
+
+// ExportUserData возвращает все данные юзера для резервной копии
+func (ss *SqliteStorage) ExportUserData(ctx context.Context, userID int64) (*repository.UserData, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ExportUserData")
+	defer span.Finish()
+
+	data := &repository.UserData{Currency: defaultCurrency}
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT name FROM categories
+			WHERE user_id = $1 AND deleted_at IS NULL
+			ORDER BY name;
+		`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				return err
+			}
+			data.Categories = append(data.Categories, name)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if data.Spendings, err = getAllSpendingsTx(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		var limit int64
+		err = tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID).Scan(&limit)
+		switch {
+		case err == nil:
+			amount := fromUnits(limit)
+			data.Limit = &amount
+		case err != sql.ErrNoRows:
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID).
+			Scan(&data.Currency)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return data, nil
+}
+
+// getAllSpendingsTx возвращает траты юзера, упорядоченные по дате
+func getAllSpendingsTx(ctx context.Context, tx *sql.Tx, userID int64) ([]*repository.SpendingData, error) {
+	const query = `
+		SELECT c.name, s.amount, s.date
+		FROM spendings s
+		JOIN categories c ON c.id = s.category_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL
+		ORDER BY s.date, s.id;
+	`
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spendings []*repository.SpendingData
+	for rows.Next() {
+		var sp repository.SpendingData
+		var amount, date int64
+		if err = rows.Scan(&sp.CategoryName, &amount, &date); err != nil {
+			return nil, err
+		}
+		sp.Amount = fromUnits(amount)
+		sp.Date = fromTime(date)
+		spendings = append(spendings, &sp)
+	}
+	return spendings, rows.Err()
+}
+
+// ImportUserData добавляет юзеру данные из резервной копии, которых у него еще нет.
+// Лимит при загрузке трат не проверяется
+func (ss *SqliteStorage) ImportUserData(ctx context.Context,
+	userID int64, data *repository.UserData) (*repository.ImportResult, error) {
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ImportUserData")
+	defer span.Finish()
+
+	result := &repository.ImportResult{}
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		categoriesBefore, err := countCategoriesTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range data.Categories {
+			_, err := getCategoryID(ctx, tx, userID, name)
+			if err == sql.ErrNoRows {
+				_, err = createCategoryTx(ctx, tx, userID, name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		existing, err := getAllSpendingsTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		missing := repository.MissingSpendings(existing, data.Spendings)
+		for _, sp := range missing {
+			err = insertSpendingTx(ctx, tx, userID, sp.CategoryName, sp.Amount, sp.Date)
+			if err != nil {
+				return err
+			}
+		}
+		result.Spendings = len(missing)
+
+		categoriesAfter, err := countCategoriesTx(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		result.Categories = categoriesAfter - categoriesBefore
+
+		if data.Limit != nil {
+			var limit int64
+			err = tx.QueryRowContext(ctx, `SELECT amount FROM limits WHERE user_id = $1;`, userID).Scan(&limit)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == sql.ErrNoRows || !fromUnits(limit).Equal(*data.Limit) {
+				if err = setLimitTx(ctx, tx, userID, *data.Limit, 0); err != nil {
+					return err
+				}
+			}
+		}
+
+		if data.Currency != "" {
+			curr := defaultCurrency
+			err = tx.QueryRowContext(ctx, `SELECT char_code FROM currencies WHERE user_id = $1;`, userID).Scan(&curr)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if curr != data.Currency {
+				return setActiveCurrencyTx(ctx, tx, userID, data.Currency, 0)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, setErrorSpanAndReturnError(span, err)
+	}
+	return result, nil
+}
+
+// Количество категорий юзера
+func countCategoriesTx(ctx context.Context, tx *sql.Tx, userID int64) (int, error) {
+	const query = `SELECT COUNT(*) FROM categories WHERE user_id = $1 AND deleted_at IS NULL;`
+	var count int
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// DeleteUserData удаляет все данные юзера вместе с журналом изменений
+// и записывает обезличенное событие удаления
+func (ss *SqliteStorage) DeleteUserData(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "DeleteUserData")
+	defer span.Finish()
+
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		// Траты и их агрегаты удаляются первыми из-за внешнего ключа на категории
+		if _, err := tx.ExecContext(ctx, `DELETE FROM spendings_daily WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+		var counts [2]int64
+		for i, table := range []string{"spendings", "categories"} {
+			result, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1;`, userID)
+			if err != nil {
+				return err
+			}
+			if counts[i], err = result.RowsAffected(); err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"currencies", "limits", "audit_log"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1;`, userID); err != nil {
+				return err
+			}
+		}
+
+		const query = `
+			INSERT INTO deletion_log(
+				categories,
+				spendings,
+				created_at
+			) VALUES (
+				$1, $2, $3
+			);
+		`
+		_, err := tx.ExecContext(ctx, query, counts[1], counts[0], toTime(time.Now()))
+		return err
+	})
+	return setErrorSpanAndReturnError(span, err)
+}
+
+// inTx выполняет fn в транзакции и откатывает ее при ошибке
+func (ss *SqliteStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		if tx.Rollback() != nil {
+			err = fmt.Errorf("%w, tx.Rollback() failed", err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// writeAudit дописывает запись в журнал изменений в транзакции самого изменения
+func writeAudit(ctx context.Context, tx *sql.Tx, record repository.AuditRecord) error {
+	const query = `
+		INSERT INTO audit_log(
+			user_id,
+			entity,
+			entity_id,
+			action,
+			old_value,
+			new_value,
+			reverts_id,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8
+		);
+	`
+	_, err := tx.ExecContext(ctx, query,
+		record.UserID,
+		record.Entity,
+		record.EntityID,
+		record.Action,
+		record.OldValue,
+		record.NewValue,
+		record.RevertsID,
+		toTime(time.Now()),
+	)
+	return err
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/migrate"
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/cr00z/goSpendingBot/internal/repository/storagertest"
+	"github.com/cr00z/goSpendingBot/migrations"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := OpenAndConnect(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	err = migrate.New(db, migrate.DialectSqlite, migrations.Sqlite).Up(context.Background(), &bytes.Buffer{})
+	require.NoError(t, err)
+	return db
+}
+
+func TestSqliteStorage_Storager(t *testing.T) {
+	storagertest.Run(t, func(t *testing.T) repository.Storager {
+		return New(openTestDB(t))
+	})
+}
+
+func TestSqliteStorage_DeleteUserData_ShouldRecordAnonymousEvent(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	ss := New(db)
+	require.NoError(t, ss.CreateCategory(ctx, 1, "taxi"))
+	require.NoError(t, ss.CreateSpending(ctx, 1, "food", decimal.NewFromInt(100), time.Now()))
+
+	require.NoError(t, ss.DeleteUserData(ctx, 1))
+
+	var categories, spendings int64
+	row := db.QueryRow(`SELECT categories, spendings FROM deletion_log;`)
+	require.NoError(t, row.Scan(&categories, &spendings))
+	assert.Equal(t, int64(2), categories)
+	assert.Equal(t, int64(1), spendings)
+}
+
+// миграция заполняет дневные агрегаты так же, как их ведет хранилище
+func TestSqliteStorage_SpendingsDailyMigration_ShouldMatchMaintainedAggregate(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	ss := New(db)
+	now := time.Now()
+	require.NoError(t, ss.CreateSpending(ctx, 1, "food", decimal.NewFromInt(100), now.AddDate(0, 0, -2)))
+	require.NoError(t, ss.CreateSpending(ctx, 1, "food", decimal.NewFromInt(50), now))
+	require.NoError(t, ss.CreateSpending(ctx, 1, "taxi", decimal.NewFromInt(300), now))
+	_, err := ss.Undo(ctx, 1, time.Hour)
+	require.NoError(t, err)
+	maintained := dailyRows(t, db)
+
+	migrator := migrate.New(db, migrate.DialectSqlite, migrations.Sqlite)
+	require.NoError(t, migrator.Down(ctx, &bytes.Buffer{}))
+	require.NoError(t, migrator.Up(ctx, &bytes.Buffer{}))
+
+	assert.Equal(t, maintained, dailyRows(t, db))
+}
+
+func dailyRows(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT user_id, day, category_id, amount FROM spendings_daily
+		WHERE amount != 0
+		ORDER BY user_id, day, category_id;
+	`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var userID, day, categoryID, amount int64
+		require.NoError(t, rows.Scan(&userID, &day, &categoryID, &amount))
+		result = append(result, fmt.Sprint(userID, " ", fromTime(day).Format("2006-01-02"), " ", categoryID, " ", amount))
+	}
+	require.NoError(t, rows.Err())
+	return result
+}
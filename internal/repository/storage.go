@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -13,6 +14,7 @@ var (
 	ErrCategoryIsEmpty = errors.New("category is empty")
 	ErrLimitNotSet     = errors.New("month limit not set")
 	ErrLimitExceeded   = errors.New("month limit exceeded")
+	ErrNothingToUndo   = errors.New("nothing to undo")
 )
 
 type Storager interface {
@@ -25,6 +27,11 @@ type Storager interface {
 	GetLimit(ctx context.Context, userID int64) (decimal.Decimal, error)
 	SetLimit(ctx context.Context, userID int64, amount decimal.Decimal) error
 	DropLimit(ctx context.Context, userID int64) error
+	GetHistory(ctx context.Context, userID int64, limit int) ([]*AuditRecord, error)
+	Undo(ctx context.Context, userID int64, window time.Duration) (*AuditRecord, error)
+	ExportUserData(ctx context.Context, userID int64) (*UserData, error)
+	ImportUserData(ctx context.Context, userID int64, data *UserData) (*ImportResult, error)
+	DeleteUserData(ctx context.Context, userID int64) error
 }
 
 type Category struct {
@@ -33,6 +40,7 @@ type Category struct {
 	Name      string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	DeletedAt *time.Time
 }
 
 type Spending struct {
@@ -43,6 +51,7 @@ type Spending struct {
 	Date       time.Time
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	DeletedAt  *time.Time
 }
 
 type ReportByCategory struct {
@@ -70,3 +79,87 @@ type Limit struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// Сущности и действия в журнале изменений
+const (
+	AuditSpending = "spending"
+	AuditCategory = "category"
+	AuditLimit    = "limit"
+	AuditCurrency = "currency"
+
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord - запись журнала изменений данных юзера. Журнал только дополняется.
+// Для траты и категории EntityID - ID строки, для лимита и валюты - 0.
+// Пустое значение означает отсутствие данных: нет лимита до установки, нет траты до создания.
+// Отмена изменения записывается обратным изменением с RevertsID отмененной записи
+type AuditRecord struct {
+	ID        int64
+	UserID    int64
+	Entity    string
+	EntityID  int64
+	Action    string
+	OldValue  string
+	NewValue  string
+	RevertsID int64
+	CreatedAt time.Time
+}
+
+// SpendingAuditValue - значение траты в журнале изменений
+func SpendingAuditValue(categoryName string, amount decimal.Decimal, date time.Time) string {
+	return categoryName + " " + amount.String() + " " + date.Format("02/01/06")
+}
+
+// UserData - все данные юзера для резервной копии.
+// Limit равен nil, если лимит не установлен
+type UserData struct {
+	Categories []string
+	Spendings  []*SpendingData
+	Limit      *decimal.Decimal
+	Currency   string
+}
+
+// ImportResult - сколько категорий и трат из резервной копии добавлено юзеру
+type ImportResult struct {
+	Categories int
+	Spendings  int
+}
+
+// SpendingData - трата в резервной копии, категория задается именем
+type SpendingData struct {
+	CategoryName string
+	Amount       decimal.Decimal
+	Date         time.Time
+}
+
+// Даты трат сверяются с точностью хранения в postgres
+const spendingDatePrecision = time.Microsecond
+
+func spendingKey(sp *SpendingData) string {
+	return sp.CategoryName + " " + sp.Amount.String() + " " +
+		strconv.FormatInt(sp.Date.Truncate(spendingDatePrecision).UnixNano(), 10)
+}
+
+// MissingSpendings возвращает траты из imported, которых нет в existing.
+// Одинаковые траты сверяются по количеству, поэтому повторная загрузка
+// той же копии ничего не добавляет
+func MissingSpendings(existing []*SpendingData, imported []*SpendingData) []*SpendingData {
+	counts := make(map[string]int, len(existing))
+	for _, sp := range existing {
+		counts[spendingKey(sp)]++
+	}
+
+	var missing []*SpendingData
+	for _, sp := range imported {
+		key := spendingKey(sp)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		missing = append(missing, sp)
+	}
+	return missing
+}
@@ -0,0 +1,688 @@
+// Package storagertest содержит общий набор тестов, который должна проходить
+// каждая реализация repository.Storager
+package storagertest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cr00z/goSpendingBot/internal/repository"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Допустимое расхождение дат при хранении в БД
+const dateDelta = time.Second
+
+// Каждый тест работает со своими юзерами, поэтому набор можно запускать
+// на общей непустой базе
+var lastUserID = time.Now().UnixNano() / int64(time.Millisecond)
+
+func newUserID() int64 {
+	return atomic.AddInt64(&lastUserID, 1)
+}
+
+// Run запускает набор тестов на хранилище, созданном newStorage
+func Run(t *testing.T, newStorage func(t *testing.T) repository.Storager) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s repository.Storager)
+	}{
+		{"CreateCategory", testCreateCategory},
+		{"CreateCategoryExists", testCreateCategoryExists},
+		{"GetAllCategoriesSortedAndIsolated", testGetAllCategoriesSortedAndIsolated},
+		{"CreateSpendingCreatesCategory", testCreateSpendingCreatesCategory},
+		{"CreateSpendingConcurrentCreatesOneCategory", testCreateSpendingConcurrentCreatesOneCategory},
+		{"ReportPeriod", testReportPeriod},
+		{"ReportPeriodEmpty", testReportPeriodEmpty},
+		{"ReportPeriodPartialDays", testReportPeriodPartialDays},
+		{"ActiveCurrencyDefault", testActiveCurrencyDefault},
+		{"SetActiveCurrency", testSetActiveCurrency},
+		{"LimitNotSet", testLimitNotSet},
+		{"SetAndDropLimit", testSetAndDropLimit},
+		{"LimitExceeded", testLimitExceeded},
+		{"LimitConcurrent", testLimitConcurrent},
+		{"History", testHistory},
+		{"HistoryLimitAndIsolation", testHistoryLimitAndIsolation},
+		{"UndoSpendingAndCategory", testUndoSpendingAndCategory},
+		{"UndoLimitAndCurrency", testUndoLimitAndCurrency},
+		{"UndoSpendingFreesLimit", testUndoSpendingFreesLimit},
+		{"UndoWindowAndIsolation", testUndoWindowAndIsolation},
+		{"ExportUserData", testExportUserData},
+		{"ExportUserDataEmpty", testExportUserDataEmpty},
+		{"ImportUserDataRoundTrip", testImportUserDataRoundTrip},
+		{"ImportUserDataIdempotent", testImportUserDataIdempotent},
+		{"DeleteUserData", testDeleteUserData},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func categoryNames(t *testing.T, s repository.Storager, userID int64) []string {
+	t.Helper()
+
+	categories, err := s.GetAllCategories(context.Background(), userID)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(categories))
+	for _, cat := range categories {
+		assert.Equal(t, userID, cat.UserID)
+		names = append(names, cat.Name)
+	}
+	return names
+}
+
+func assertDecimal(t *testing.T, expected string, actual decimal.Decimal) {
+	t.Helper()
+	assert.True(t, decimal.RequireFromString(expected).Equal(actual),
+		"expected %s, actual %s", expected, actual)
+}
+
+func testCreateCategory(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+
+	err := s.CreateCategory(ctx, userID, "food")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
+
+func testCreateCategoryExists(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+
+	err := s.CreateCategory(ctx, userID, "food")
+
+	assert.ErrorIs(t, err, repository.ErrCategoryExists)
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
+
+func testGetAllCategoriesSortedAndIsolated(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	otherUserID := newUserID()
+	require.NoError(t, s.CreateCategory(ctx, userID, "taxi"))
+	require.NoError(t, s.CreateCategory(ctx, otherUserID, "books"))
+	require.NoError(t, s.CreateCategory(ctx, userID, "coffee"))
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+
+	assert.Equal(t, []string{"coffee", "food", "taxi"}, categoryNames(t, s, userID))
+	assert.Equal(t, []string{"books"}, categoryNames(t, s, otherUserID))
+	assert.Empty(t, categoryNames(t, s, newUserID()))
+}
+
+func testCreateSpendingCreatesCategory(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+
+	err := s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(100), time.Now())
+	require.NoError(t, err)
+	err = s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(50), time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
+
+func testCreateSpendingConcurrentCreatesOneCategory(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+
+	// Параллельные первые траты в новой категории создают ее один раз
+	const attempts = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(10), time.Now())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
+
+func testReportPeriod(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now().UTC().Truncate(time.Second)
+	dateFirst := now.AddDate(0, 0, -7)
+
+	spendings := []struct {
+		userID   int64
+		category string
+		amount   string
+		date     time.Time
+	}{
+		{userID, "taxi", "700", dateFirst},
+		{userID, "food", "100.5", now.AddDate(0, 0, -1)},
+		{userID, "food", "49.5", now},
+		{userID, "coffee", "250", now.AddDate(0, 0, -8)},
+		{newUserID(), "food", "1000", now},
+	}
+	for _, sp := range spendings {
+		err := s.CreateSpending(ctx, sp.userID, sp.category, decimal.RequireFromString(sp.amount), sp.date)
+		require.NoError(t, err)
+	}
+
+	report, err := s.ReportPeriod(ctx, userID, dateFirst, now)
+
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 2) {
+		assert.Equal(t, "food", report.ReportByCategory[0].CategoryName)
+		assertDecimal(t, "150", report.ReportByCategory[0].Sum)
+		assert.Equal(t, "taxi", report.ReportByCategory[1].CategoryName)
+		assertDecimal(t, "700", report.ReportByCategory[1].Sum)
+	}
+	assert.WithinDuration(t, dateFirst, report.MinDate, dateDelta)
+}
+
+func testReportPeriodEmpty(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+
+	report, err := s.ReportPeriod(ctx, userID, now.AddDate(0, -1, 0), now)
+
+	require.NoError(t, err)
+	assert.Empty(t, report.ReportByCategory)
+	// Пустой отчет актуален для любого периода, заканчивающегося сейчас
+	assert.False(t, report.MinDate.Before(now))
+}
+
+func testReportPeriodPartialDays(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	year, month, day := time.Now().UTC().AddDate(0, 0, -10).Date()
+	dateFirst := time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	dateLast := dateFirst.AddDate(0, 0, 5)
+
+	// Границы периода могут приходиться на середину дня, траты за их пределами
+	// в те же дни в отчет не попадают
+	spendings := []struct {
+		amount string
+		date   time.Time
+	}{
+		{"1", dateFirst.Add(-time.Hour)},
+		{"10", dateFirst.Add(time.Hour)},
+		{"100", dateFirst.AddDate(0, 0, 1)},
+		{"1000", dateFirst.AddDate(0, 0, 3).Add(-13 * time.Hour)},
+		{"10000", dateLast.Add(-time.Hour)},
+		{"100000", dateLast.Add(time.Hour)},
+	}
+	for _, sp := range spendings {
+		err := s.CreateSpending(ctx, userID, "food", decimal.RequireFromString(sp.amount), sp.date)
+		require.NoError(t, err)
+	}
+
+	report, err := s.ReportPeriod(ctx, userID, dateFirst, dateLast)
+
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assertDecimal(t, "11110", report.ReportByCategory[0].Sum)
+	}
+	assert.False(t, report.MinDate.Before(dateFirst.Add(-dateDelta)))
+}
+
+func testActiveCurrencyDefault(t *testing.T, s repository.Storager) {
+	curr, err := s.GetActiveCurrency(context.Background(), newUserID())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "RUB", curr)
+}
+
+func testSetActiveCurrency(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "USD"))
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "EUR"))
+
+	curr, err := s.GetActiveCurrency(ctx, userID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", curr)
+}
+
+func testLimitNotSet(t *testing.T, s repository.Storager) {
+	_, err := s.GetLimit(context.Background(), newUserID())
+
+	assert.ErrorIs(t, err, repository.ErrLimitNotSet)
+}
+
+func testSetAndDropLimit(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(500)))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.RequireFromString("1000.25")))
+
+	limit, err := s.GetLimit(ctx, userID)
+	require.NoError(t, err)
+	assertDecimal(t, "1000.25", limit)
+
+	require.NoError(t, s.DropLimit(ctx, userID))
+	_, err = s.GetLimit(ctx, userID)
+	assert.ErrorIs(t, err, repository.ErrLimitNotSet)
+}
+
+func testLimitExceeded(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(100)))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(60), now))
+
+	err := s.CreateSpending(ctx, userID, "taxi", decimal.NewFromInt(50), now)
+	assert.ErrorIs(t, err, repository.ErrLimitExceeded)
+
+	// Трата ровно до лимита допустима
+	err = s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(40), now)
+	assert.NoError(t, err)
+
+	// Отклоненная трата не создает категорию и не попадает в отчет
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+	report, err := s.ReportPeriod(ctx, userID, now.AddDate(0, 0, -1), now.Add(time.Second))
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assertDecimal(t, "100", report.ReportByCategory[0].Sum)
+	}
+}
+
+func testLimitConcurrent(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(50)))
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+
+	// Лимит пропускает ровно 5 трат из 20 конкурентных
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(10), now)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var created int
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, repository.ErrLimitExceeded)
+	}
+	assert.Equal(t, 5, created)
+
+	report, err := s.ReportPeriod(ctx, userID, now.AddDate(0, 0, -1), now.Add(time.Second))
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assertDecimal(t, "50", report.ReportByCategory[0].Sum)
+	}
+}
+
+func testHistory(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	date := time.Date(2022, time.November, 20, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.CreateCategory(ctx, userID, "taxi"))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(450), date))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(1000)))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.RequireFromString("2000.5")))
+	require.NoError(t, s.DropLimit(ctx, userID))
+	// Удаление несуществующего лимита ничего не меняет
+	require.NoError(t, s.DropLimit(ctx, userID))
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "USD"))
+
+	history, err := s.GetHistory(ctx, userID, 100)
+
+	require.NoError(t, err)
+	type change struct {
+		entity, action, oldValue, newValue string
+	}
+	var changes []change
+	for _, record := range history {
+		assert.Equal(t, userID, record.UserID)
+		assert.WithinDuration(t, time.Now(), record.CreatedAt, time.Minute)
+		changes = append(changes, change{record.Entity, record.Action, record.OldValue, record.NewValue})
+	}
+	assert.Equal(t, []change{
+		{repository.AuditCurrency, repository.AuditUpdate, "RUB", "USD"},
+		{repository.AuditLimit, repository.AuditDelete, "2000.5", ""},
+		{repository.AuditLimit, repository.AuditUpdate, "1000", "2000.5"},
+		{repository.AuditLimit, repository.AuditCreate, "", "1000"},
+		{repository.AuditSpending, repository.AuditCreate, "", "food 450 20/11/22"},
+		{repository.AuditCategory, repository.AuditCreate, "", "food"},
+		{repository.AuditCategory, repository.AuditCreate, "", "taxi"},
+	}, changes)
+
+	if assert.Len(t, history, 7) {
+		assert.NotZero(t, history[4].EntityID)
+		assert.NotZero(t, history[5].EntityID)
+		assert.NotEqual(t, history[5].EntityID, history[6].EntityID)
+	}
+}
+
+func testHistoryLimitAndIsolation(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	otherUserID := newUserID()
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, s.CreateCategory(ctx, userID, name))
+		require.NoError(t, s.CreateCategory(ctx, otherUserID, name+name))
+	}
+
+	history, err := s.GetHistory(ctx, userID, 2)
+
+	require.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "c", history[0].NewValue)
+		assert.Equal(t, "b", history[1].NewValue)
+	}
+	empty, err := s.GetHistory(ctx, newUserID(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testUndoSpendingAndCategory(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	monthAgo := now.AddDate(0, -1, 0)
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(100), now))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(50), now))
+
+	undone, err := s.Undo(ctx, userID, time.Hour)
+
+	require.NoError(t, err)
+	assert.Equal(t, repository.AuditSpending, undone.Entity)
+	assert.Equal(t, repository.AuditCreate, undone.Action)
+	assert.Equal(t, repository.SpendingAuditValue("food", decimal.NewFromInt(50), now), undone.NewValue)
+	report, err := s.ReportPeriod(ctx, userID, monthAgo, now.Add(time.Minute))
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assertDecimal(t, "100", report.ReportByCategory[0].Sum)
+	}
+
+	// Повторные отмены откатывают изменения по одному
+	undone, err = s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, repository.AuditSpending, undone.Entity)
+	report, err = s.ReportPeriod(ctx, userID, monthAgo, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, report.ReportByCategory)
+
+	undone, err = s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, repository.AuditCategory, undone.Entity)
+	assert.Equal(t, "food", undone.NewValue)
+	assert.Empty(t, categoryNames(t, s, userID))
+
+	_, err = s.Undo(ctx, userID, time.Hour)
+	assert.ErrorIs(t, err, repository.ErrNothingToUndo)
+
+	// Имя отмененной категории можно использовать снова
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
+
+func testUndoLimitAndCurrency(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(1000)))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(2000)))
+	require.NoError(t, s.DropLimit(ctx, userID))
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "USD"))
+
+	undone, err := s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, repository.AuditCurrency, undone.Entity)
+	curr, err := s.GetActiveCurrency(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "RUB", curr)
+
+	_, err = s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	limit, err := s.GetLimit(ctx, userID)
+	require.NoError(t, err)
+	assertDecimal(t, "2000", limit)
+
+	_, err = s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	limit, err = s.GetLimit(ctx, userID)
+	require.NoError(t, err)
+	assertDecimal(t, "1000", limit)
+
+	_, err = s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+	_, err = s.GetLimit(ctx, userID)
+	assert.ErrorIs(t, err, repository.ErrLimitNotSet)
+
+	// Отмены пишутся в журнал и ссылаются на отмененные записи
+	history, err := s.GetHistory(ctx, userID, 100)
+	require.NoError(t, err)
+	if assert.Len(t, history, 8) {
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, history[4+i].ID, history[3-i].RevertsID)
+			assert.Equal(t, history[4+i].Entity, history[3-i].Entity)
+			assert.Zero(t, history[4+i].RevertsID)
+		}
+		assert.Equal(t, "USD", history[3].OldValue)
+		assert.Equal(t, "RUB", history[3].NewValue)
+	}
+}
+
+func testUndoSpendingFreesLimit(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(100)))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(80), now))
+	require.ErrorIs(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(90), now),
+		repository.ErrLimitExceeded)
+
+	_, err := s.Undo(ctx, userID, time.Hour)
+
+	require.NoError(t, err)
+	assert.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(90), now))
+}
+
+func testUndoWindowAndIsolation(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	otherUserID := newUserID()
+	require.NoError(t, s.CreateCategory(ctx, userID, "food"))
+	require.NoError(t, s.CreateCategory(ctx, otherUserID, "taxi"))
+
+	// Изменение старше окна не отменяется
+	_, err := s.Undo(ctx, userID, 0)
+	assert.ErrorIs(t, err, repository.ErrNothingToUndo)
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+
+	undone, err := s.Undo(ctx, userID, time.Hour)
+
+	require.NoError(t, err)
+	assert.Equal(t, userID, undone.UserID)
+	assert.Empty(t, categoryNames(t, s, userID))
+	assert.Equal(t, []string{"taxi"}, categoryNames(t, s, otherUserID))
+	_, err = s.Undo(ctx, newUserID(), time.Hour)
+	assert.ErrorIs(t, err, repository.ErrNothingToUndo)
+}
+
+func testExportUserData(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	date := time.Date(2022, time.November, 20, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.CreateCategory(ctx, userID, "taxi"))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.RequireFromString("450.5"), date.AddDate(0, 0, 1)))
+	require.NoError(t, s.CreateSpending(ctx, userID, "coffee", decimal.NewFromInt(100), date))
+	require.NoError(t, s.CreateSpending(ctx, newUserID(), "books", decimal.NewFromInt(700), date))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(5000)))
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "USD"))
+
+	data, err := s.ExportUserData(ctx, userID)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"coffee", "food", "taxi"}, data.Categories)
+	if assert.Len(t, data.Spendings, 2) {
+		assert.Equal(t, "coffee", data.Spendings[0].CategoryName)
+		assertDecimal(t, "100", data.Spendings[0].Amount)
+		assert.WithinDuration(t, date, data.Spendings[0].Date, dateDelta)
+		assert.Equal(t, "food", data.Spendings[1].CategoryName)
+		assertDecimal(t, "450.5", data.Spendings[1].Amount)
+	}
+	if assert.NotNil(t, data.Limit) {
+		assertDecimal(t, "5000", *data.Limit)
+	}
+	assert.Equal(t, "USD", data.Currency)
+}
+
+func testExportUserDataEmpty(t *testing.T, s repository.Storager) {
+	data, err := s.ExportUserData(context.Background(), newUserID())
+
+	require.NoError(t, err)
+	assert.Empty(t, data.Categories)
+	assert.Empty(t, data.Spendings)
+	assert.Nil(t, data.Limit)
+	assert.Equal(t, "RUB", data.Currency)
+}
+
+func testImportUserDataRoundTrip(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	now := time.Now()
+	require.NoError(t, s.CreateCategory(ctx, userID, "taxi"))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(80), now.Add(-time.Hour)))
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(80), now.Add(-time.Hour)))
+	require.NoError(t, s.SetLimit(ctx, userID, decimal.NewFromInt(100)))
+	require.NoError(t, s.SetActiveCurrency(ctx, userID, "EUR"))
+	data, err := s.ExportUserData(ctx, userID)
+	require.NoError(t, err)
+	otherUserID := newUserID()
+
+	// Траты загружаются даже сверх лимита из копии
+	result, err := s.ImportUserData(ctx, otherUserID, data)
+
+	require.NoError(t, err)
+	assert.Equal(t, &repository.ImportResult{Categories: 2, Spendings: 2}, result)
+	imported, err := s.ExportUserData(ctx, otherUserID)
+	require.NoError(t, err)
+	assert.Equal(t, data.Categories, imported.Categories)
+	assert.Len(t, imported.Spendings, 2)
+	if assert.NotNil(t, imported.Limit) {
+		assertDecimal(t, "100", *imported.Limit)
+	}
+	assert.Equal(t, "EUR", imported.Currency)
+	report, err := s.ReportPeriod(ctx, otherUserID, now.AddDate(0, 0, -1), now)
+	require.NoError(t, err)
+	if assert.Len(t, report.ReportByCategory, 1) {
+		assertDecimal(t, "160", report.ReportByCategory[0].Sum)
+	}
+}
+
+func testImportUserDataIdempotent(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	date := time.Date(2022, time.November, 20, 12, 30, 15, 123456000, time.UTC)
+	limit := decimal.NewFromInt(1000)
+	data := &repository.UserData{
+		Categories: []string{"food", "taxi"},
+		Spendings: []*repository.SpendingData{
+			{CategoryName: "food", Amount: decimal.NewFromInt(100), Date: date},
+			{CategoryName: "food", Amount: decimal.NewFromInt(100), Date: date},
+			{CategoryName: "books", Amount: decimal.RequireFromString("99.99"), Date: date.AddDate(0, 0, 1)},
+		},
+		Limit:    &limit,
+		Currency: "USD",
+	}
+	// Одна из трат уже есть у юзера, она не дублируется
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(100), date))
+
+	result, err := s.ImportUserData(ctx, userID, data)
+	require.NoError(t, err)
+	// Категория books есть только у трат копии
+	assert.Equal(t, &repository.ImportResult{Categories: 2, Spendings: 2}, result)
+	historySize := len(mustHistory(t, s, userID))
+	result, err = s.ImportUserData(ctx, userID, data)
+	require.NoError(t, err)
+	assert.Equal(t, &repository.ImportResult{}, result)
+
+	imported, err := s.ExportUserData(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"books", "food", "taxi"}, imported.Categories)
+	assert.Len(t, imported.Spendings, 3)
+	// Повторная загрузка ничего не меняет и не пишет в журнал
+	assert.Len(t, mustHistory(t, s, userID), historySize)
+}
+
+func mustHistory(t *testing.T, s repository.Storager, userID int64) []*repository.AuditRecord {
+	t.Helper()
+
+	history, err := s.GetHistory(context.Background(), userID, 1000)
+	require.NoError(t, err)
+	return history
+}
+
+func testDeleteUserData(t *testing.T, s repository.Storager) {
+	ctx := context.Background()
+	userID := newUserID()
+	otherUserID := newUserID()
+	now := time.Now()
+	for _, id := range []int64{userID, otherUserID} {
+		require.NoError(t, s.CreateCategory(ctx, id, "taxi"))
+		require.NoError(t, s.CreateSpending(ctx, id, "food", decimal.NewFromInt(100), now))
+		require.NoError(t, s.SetLimit(ctx, id, decimal.NewFromInt(1000)))
+		require.NoError(t, s.SetActiveCurrency(ctx, id, "USD"))
+	}
+	require.NoError(t, s.CreateSpending(ctx, userID, "coffee", decimal.NewFromInt(50), now))
+	_, err := s.Undo(ctx, userID, time.Hour)
+	require.NoError(t, err)
+
+	err = s.DeleteUserData(ctx, userID)
+
+	require.NoError(t, err)
+	data, err := s.ExportUserData(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, data.Categories)
+	assert.Empty(t, data.Spendings)
+	assert.Nil(t, data.Limit)
+	assert.Equal(t, "RUB", data.Currency)
+	assert.Empty(t, mustHistory(t, s, userID))
+	report, err := s.ReportPeriod(ctx, userID, now.AddDate(0, 0, -1), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, report.ReportByCategory)
+	_, err = s.Undo(ctx, userID, time.Hour)
+	assert.ErrorIs(t, err, repository.ErrNothingToUndo)
+
+	// Данные других юзеров не затрагиваются
+	other, err := s.ExportUserData(ctx, otherUserID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"food", "taxi"}, other.Categories)
+	assert.Len(t, other.Spendings, 1)
+	assert.NotEmpty(t, mustHistory(t, s, otherUserID))
+
+	// После удаления юзер начинает с чистого аккаунта
+	require.NoError(t, s.CreateSpending(ctx, userID, "food", decimal.NewFromInt(100), now))
+	assert.Equal(t, []string{"food"}, categoryNames(t, s, userID))
+}
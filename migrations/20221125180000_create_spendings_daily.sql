@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+--
+create table spendings_daily (
+user_id bigint not null,
+day date not null,
+category_id bigint not null,
+amount decimal(20, 8) not null,
+primary key (user_id, day, category_id)
+);
+--
+insert into spendings_daily(user_id, day, category_id, amount)
+select user_id, date::date, category_id, sum(amount)
+from spendings
+group by user_id, date::date, category_id;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+--
+DROP TABLE spendings_daily;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+--
+alter table categories add column deleted_at timestamp;
+--
+alter table spendings add column deleted_at timestamp;
+--
+create table audit_log (
+id bigserial primary key,
+user_id bigint not null,
+entity text not null,
+entity_id bigint not null,
+action text not null,
+old_value text not null,
+new_value text not null,
+created_at timestamp not null
+);
+--
+create index audit_log_user_id_id_idx on audit_log(user_id, id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+--
+DROP TABLE audit_log;
+--
+ALTER TABLE spendings DROP COLUMN deleted_at;
+--
+ALTER TABLE categories DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+--
+-- Запись об отмене изменения ссылается на отмененную запись, 0 - обычное изменение
+alter table audit_log add column reverts_id bigint not null default 0;
+--
+-- Изменение отменяется не больше одного раза, в том числе при параллельных /undo
+create unique index audit_log_reverts_id_idx on audit_log(reverts_id) where reverts_id <> 0;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+--
+DROP INDEX audit_log_reverts_id_idx;
+--
+ALTER TABLE audit_log DROP COLUMN reverts_id;
+-- +goose StatementEnd
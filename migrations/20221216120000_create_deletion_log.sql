@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+--
+-- Обезличенный учет удалений данных по просьбе юзера: без user_id, только объем удаленного
+create table deletion_log (
+id bigserial primary key,
+categories bigint not null,
+spendings bigint not null,
+created_at timestamp not null
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+--
+DROP TABLE deletion_log;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+--
+-- Дубли категорий, созданные параллельными тратами, сливаются в самую раннюю
+update spendings sp set category_id = d.keep_id
+from (
+select id, min(id) over (partition by user_id, name) as keep_id
+from categories
+where deleted_at is null
+) d
+where sp.category_id = d.id and d.id <> d.keep_id;
+--
+insert into spendings_daily(user_id, day, category_id, amount)
+select sd.user_id, sd.day, d.keep_id, sum(sd.amount)
+from spendings_daily sd
+join (
+select id, min(id) over (partition by user_id, name) as keep_id
+from categories
+where deleted_at is null
+) d on sd.category_id = d.id and d.id <> d.keep_id
+group by sd.user_id, sd.day, d.keep_id
+on conflict (user_id, day, category_id) do update
+set amount = spendings_daily.amount + excluded.amount;
+--
+delete from spendings_daily sd
+using (
+select id, min(id) over (partition by user_id, name) as keep_id
+from categories
+where deleted_at is null
+) d
+where sd.category_id = d.id and d.id <> d.keep_id;
+--
+update categories c set deleted_at = now(), updated_at = now()
+from (
+select id, min(id) over (partition by user_id, name) as keep_id
+from categories
+where deleted_at is null
+) d
+where c.id = d.id and d.id <> d.keep_id;
+--
+create unique index categories_user_id_name_idx on categories(user_id, name) where deleted_at is null;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+--
+DROP INDEX categories_user_id_name_idx;
+-- +goose StatementEnd
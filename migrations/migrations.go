@@ -0,0 +1,26 @@
+// Package migrations встраивает SQL-миграции в бинарники бота и сервиса отчетов
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Postgres содержит миграции postgres в формате goose
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// Sqlite содержит миграции sqlite в формате goose
+var Sqlite = mustSub(sqlite, "sqlite")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
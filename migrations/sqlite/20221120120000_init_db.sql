@@ -0,0 +1,50 @@
+-- Суммы хранятся в целых единицах 1e-8 (как decimal(20, 8) в postgres),
+-- даты - в наносекундах unix time, чтобы агрегаты считались точно
+-- +goose Up
+-- +goose StatementBegin
+create table categories (
+id integer primary key autoincrement,
+user_id integer not null,
+name text not null,
+created_at integer,
+updated_at integer
+);
+--
+create table currencies (
+user_id integer primary key,
+char_code text not null,
+created_at integer,
+updated_at integer
+);
+--
+create table spendings (
+id integer primary key autoincrement,
+user_id integer not null,
+category_id integer not null references categories(id),
+amount integer not null,
+date integer not null,
+created_at integer,
+updated_at integer
+);
+--
+create table limits (
+user_id integer primary key,
+amount integer not null,
+created_at integer,
+updated_at integer
+);
+--
+create unique index categories_user_id_name_idx on categories(user_id, name);
+--
+create index spendings_user_id_date_idx on spendings(user_id, date);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE spendings;
+--
+DROP TABLE categories;
+--
+DROP TABLE currencies;
+--
+DROP TABLE limits;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table categories add column deleted_at integer;
+--
+alter table spendings add column deleted_at integer;
+--
+-- Имя удаленной категории можно использовать снова
+drop index categories_user_id_name_idx;
+--
+create unique index categories_user_id_name_idx on categories(user_id, name) where deleted_at is null;
+--
+create table audit_log (
+id integer primary key autoincrement,
+user_id integer not null,
+entity text not null,
+entity_id integer not null,
+action text not null,
+old_value text not null,
+new_value text not null,
+created_at integer not null
+);
+--
+create index audit_log_user_id_id_idx on audit_log(user_id, id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table audit_log;
+--
+drop index categories_user_id_name_idx;
+--
+create unique index categories_user_id_name_idx on categories(user_id, name);
+--
+alter table spendings drop column deleted_at;
+--
+alter table categories drop column deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Запись об отмене изменения ссылается на отмененную запись, 0 - обычное изменение
+alter table audit_log add column reverts_id integer not null default 0;
+--
+-- Изменение отменяется не больше одного раза, в том числе при параллельных /undo
+create unique index audit_log_reverts_id_idx on audit_log(reverts_id) where reverts_id <> 0;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop index audit_log_reverts_id_idx;
+--
+alter table audit_log drop column reverts_id;
+-- +goose StatementEnd
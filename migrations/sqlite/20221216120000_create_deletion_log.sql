@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Обезличенный учет удалений данных по просьбе юзера: без user_id, только объем удаленного
+create table deletion_log (
+id integer primary key autoincrement,
+categories integer not null,
+spendings integer not null,
+created_at integer not null
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table deletion_log;
+-- +goose StatementEnd
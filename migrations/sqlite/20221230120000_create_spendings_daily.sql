@@ -0,0 +1,26 @@
+-- Дневные агрегаты трат, как spendings_daily в postgres. День хранится
+-- началом суток в наносекундах unix time, при заполнении сутки берутся
+-- в часовом поясе процесса, так же как их считает бот
+-- +goose Up
+-- +goose StatementBegin
+create table spendings_daily (
+user_id integer not null,
+day integer not null,
+category_id integer not null references categories(id),
+amount integer not null,
+primary key (user_id, day, category_id)
+);
+--
+insert into spendings_daily(user_id, day, category_id, amount)
+select user_id,
+       strftime('%s', date(date / 1000000000, 'unixepoch', 'localtime'), 'utc') * 1000000000,
+       category_id,
+       sum(amount)
+from spendings
+where deleted_at is null
+group by 1, 2, 3;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+drop table spendings_daily;
+-- +goose StatementEnd